@@ -0,0 +1,112 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SD WebUI在cache.json中记录的文件Hash，mtime为文件修改时间的Unix时间戳（秒，带有小数部分）。
+type WebUIHashCacheEntry struct {
+	MTime  float64 `json:"mtime"`
+	SHA256 string  `json:"sha256"`
+}
+
+type webUICacheFile struct {
+	Hashes map[string]WebUIHashCacheEntry `json:"hashes"`
+}
+
+// 已经加载的cache.json内容，只有在cache.json发生变化之后才会重新加载。
+var (
+	webUIHashCache        map[string]WebUIHashCacheEntry
+	webUIHashCachePath    string
+	webUIHashCacheModTime int64
+	webUIHashCacheLock    sync.Mutex
+)
+
+// 修改时间比对允许的误差，SD WebUI使用浮点数记录修改时间，会损失一部分精度。
+const webUICacheMTimeTolerance = 1e-3
+
+func (c A111StableDiffusionWebUIConfig) HashCachePath() string {
+	return filepath.Join(c.BasePath, "cache.json")
+}
+
+// 加载SD WebUI的cache.json中记录的文件Hash。
+func (c A111StableDiffusionWebUIConfig) loadHashCache() (map[string]WebUIHashCacheEntry, error) {
+	cachePath := c.HashCachePath()
+	stat, err := os.Stat(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	webUIHashCacheLock.Lock()
+	defer webUIHashCacheLock.Unlock()
+	if webUIHashCache != nil && webUIHashCachePath == cachePath && webUIHashCacheModTime == stat.ModTime().UnixNano() {
+		return webUIHashCache, nil
+	}
+	content, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, fmt.Errorf("未能读取SD WebUI的缓存文件，%w", err)
+	}
+	var cacheFile webUICacheFile
+	if err := json.Unmarshal(content, &cacheFile); err != nil {
+		return nil, fmt.Errorf("未能解析SD WebUI的缓存文件，%w", err)
+	}
+	if cacheFile.Hashes == nil {
+		cacheFile.Hashes = make(map[string]WebUIHashCacheEntry, 0)
+	}
+	webUIHashCache = cacheFile.Hashes
+	webUIHashCachePath = cachePath
+	webUIHashCacheModTime = stat.ModTime().UnixNano()
+	return webUIHashCache, nil
+}
+
+// SD WebUI使用模型类别与模型名称组成的标题作为缓存的键。Checkpoint的名称是其相对于模型目录的路径，
+// LoRA和Embedding的名称是不含扩展名的文件名。
+func (c A111StableDiffusionWebUIConfig) hashCacheTitles(filePath string) []string {
+	titles := make([]string, 0)
+	baseName := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	if len(c.Checkpoint) > 0 && IsSubDir(c.Checkpoint, filePath) {
+		if relPath, err := filepath.Rel(c.Checkpoint, filePath); err == nil {
+			titles = append(titles, "checkpoint/"+relPath, "checkpoint/"+filepath.ToSlash(relPath))
+		}
+	}
+	if (len(c.Lora) > 0 && IsSubDir(c.Lora, filePath)) || (len(c.LyCORIS) > 0 && IsSubDir(c.LyCORIS, filePath)) {
+		titles = append(titles, "lora/"+baseName)
+	}
+	if len(c.Embedding) > 0 && IsSubDir(c.Embedding, filePath) {
+		titles = append(titles, "textual_inversion/"+baseName)
+	}
+	return titles
+}
+
+// 从SD WebUI的cache.json中查找指定文件的SHA256值。只有在缓存记录的修改时间与文件当前的修改时间一致时才会返回，
+// modTime为文件修改时间的Unix纳秒时间戳。SD WebUI未配置或者不存在cache.json时不会返回错误。
+func LookupWebUIHashCache(filePath string, modTime int64) (string, bool, error) {
+	if ApplicationSetup == nil || ApplicationSetup.WebUIConfig == nil || len(ApplicationSetup.WebUIConfig.BasePath) == 0 {
+		return "", false, nil
+	}
+	webUIConfig := *ApplicationSetup.WebUIConfig
+	cache, err := webUIConfig.loadHashCache()
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	for _, title := range webUIConfig.hashCacheTitles(filePath) {
+		entry, ok := cache[title]
+		if !ok || len(entry.SHA256) != 64 {
+			continue
+		}
+		if math.Abs(entry.MTime-float64(modTime)/1e9) > webUICacheMTimeTolerance {
+			continue
+		}
+		return strings.ToUpper(entry.SHA256), true, nil
+	}
+	return "", false, nil
+}
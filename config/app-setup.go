@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -61,6 +62,7 @@ func (a ApplicationSettings) SaveNewProxySetting(use bool, protocol string, host
 		return false
 	}
 	ApplicationSetup = LoadConfiguration()
+	notifyConfigurationChanged()
 	return true
 }
 
@@ -120,6 +122,7 @@ func (a ApplicationSettings) SaveNewWebUIConfig(config A111StableDiffusionWebUIC
 		return false
 	}
 	ApplicationSetup = LoadConfiguration()
+	notifyConfigurationChanged()
 	return true
 }
 
@@ -130,6 +133,7 @@ func (a ApplicationSettings) ClearWebUIConfig() bool {
 		return false
 	}
 	ApplicationSetup = LoadConfiguration()
+	notifyConfigurationChanged()
 	return true
 }
 
@@ -147,6 +151,7 @@ func (a ApplicationSettings) SaveNewComfyUIConfig(config ComfyUIConfig) bool {
 		return false
 	}
 	ApplicationSetup = LoadConfiguration()
+	notifyConfigurationChanged()
 	return true
 }
 
@@ -157,6 +162,7 @@ func (a ApplicationSettings) ClearComfyUIConfig() bool {
 		return false
 	}
 	ApplicationSetup = LoadConfiguration()
+	notifyConfigurationChanged()
 	return true
 }
 
@@ -174,5 +180,129 @@ func (a ApplicationSettings) SaveNewAppBehaviours(behaviours AppBehaviours) bool
 		return false
 	}
 	ApplicationSetup = LoadConfiguration()
+	notifyConfigurationChanged()
+	return true
+}
+
+func (a ApplicationSettings) GetCurrentModelExtensions() map[string][]string {
+	return ModelExtensions()
+}
+
+func (a ApplicationSettings) SaveNewModelExtensions(extensions map[string][]string) bool {
+	if ApplicationSetup == nil {
+		return false
+	}
+	normalized := make(map[string][]string, len(extensions))
+	for modelType, exts := range extensions {
+		normalized[normalizeModelType(modelType)] = normalizeExtensions(exts)
+	}
+	ApplicationSetup.ModelExtensions = normalized
+	err := ApplicationSetup.Save()
+	if err != nil {
+		return false
+	}
+	ApplicationSetup = LoadConfiguration()
+	notifyConfigurationChanged()
+	return true
+}
+
+func (a ApplicationSettings) GetCurrentIOConfig() IOConfig {
+	return IOSettings()
+}
+
+func (a ApplicationSettings) SaveNewIOConfig(ioConfig IOConfig) bool {
+	if ApplicationSetup == nil {
+		return false
+	}
+	ApplicationSetup.IOConfig = &ioConfig
+	err := ApplicationSetup.Save()
+	if err != nil {
+		return false
+	}
+	ApplicationSetup = LoadConfiguration()
+	notifyConfigurationChanged()
+	return true
+}
+
+func (a ApplicationSettings) GetCurrentNetworkConfig() NetworkConfig {
+	return NetworkSettings()
+}
+
+func (a ApplicationSettings) SaveNewNetworkConfig(networkConfig NetworkConfig) bool {
+	if ApplicationSetup == nil {
+		return false
+	}
+	ApplicationSetup.NetworkConfig = &networkConfig
+	err := ApplicationSetup.Save()
+	if err != nil {
+		return false
+	}
+	ApplicationSetup = LoadConfiguration()
+	notifyConfigurationChanged()
+	return true
+}
+
+// 只返回是否已经配置了Civitai API密钥，密钥本身不会返回给前端。
+func (a ApplicationSettings) HasCivitaiAPIKey() bool {
+	return len(CivitaiAPIKey()) > 0
+}
+
+// 保存新的Civitai API密钥，传入空字符串时清除已经保存的密钥。
+func (a ApplicationSettings) SaveCivitaiAPIKey(apiKey string) bool {
+	if ApplicationSetup == nil {
+		return false
+	}
+	if ApplicationSetup.CivitaiConfig == nil {
+		ApplicationSetup.CivitaiConfig = &CivitaiConfig{}
+	}
+	if err := ApplicationSetup.CivitaiConfig.SetAPIKey(strings.TrimSpace(apiKey)); err != nil {
+		return false
+	}
+	err := ApplicationSetup.Save()
+	if err != nil {
+		return false
+	}
+	ApplicationSetup = LoadConfiguration()
+	notifyConfigurationChanged()
+	return true
+}
+
+func (a ApplicationSettings) GetCivitaiEndpoints() CivitaiEndpoints {
+	return CivitaiEndpoints{
+		APIBases:      CivitaiAPIBases(),
+		DownloadHosts: CivitaiDownloadHosts(),
+		APIKeyHosts:   CivitaiAPIKeyHosts(),
+	}
+}
+
+// 保存Civitai访问地址，传入空列表时恢复使用Civitai官方地址。允许接收API密钥的主机必须是已配置的https地址，否则不会保存。
+func (a ApplicationSettings) SaveCivitaiEndpoints(endpoints CivitaiEndpoints) bool {
+	if ApplicationSetup == nil {
+		return false
+	}
+	apiBases, err := normalizeEndpoints(endpoints.APIBases)
+	if err != nil {
+		return false
+	}
+	downloadHosts, err := normalizeEndpoints(endpoints.DownloadHosts)
+	if err != nil {
+		return false
+	}
+	apiKeyHosts, err := normalizeAPIKeyHosts(endpoints.APIKeyHosts, append(apiBases, downloadHosts...))
+	if err != nil {
+		return false
+	}
+	if ApplicationSetup.CivitaiConfig == nil {
+		ApplicationSetup.CivitaiConfig = &CivitaiConfig{}
+	}
+	ApplicationSetup.CivitaiConfig.APIBases = apiBases
+	ApplicationSetup.CivitaiConfig.DownloadHosts = downloadHosts
+	ApplicationSetup.CivitaiConfig.APIKeyHosts = apiKeyHosts
+	err = ApplicationSetup.Save()
+	if err != nil {
+		return false
+	}
+	ApplicationSetup = LoadConfiguration()
+	notifyConfigurationChanged()
 	return true
 }
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"archgrid.xyz/ag/toolsbox/encryption/spiral"
+	"github.com/samber/lo"
+)
+
+// 未配置时使用的Civitai官方地址。
+const (
+	DefaultCivitaiAPIBase      = "https://civitai.com/api/v1"
+	DefaultCivitaiDownloadHost = "https://civitai.com"
+)
+
+// 访问Civitai时使用的配置。
+type CivitaiConfig struct {
+	APIKey *string `yaml:"api_key,omitempty" json:"apiKey,omitempty"` // 使用spiral加密保存的API密钥，用于下载需要登录或者处于抢先体验阶段的模型。
+	// 按照顺序尝试的API地址，例如地区镜像或者内部的缓存代理，前面的地址无法访问时使用后面的地址。未配置时使用Civitai官方地址。
+	APIBases []string `yaml:"api_bases,omitempty" json:"apiBases"`
+	// 按照顺序尝试的模型文件下载地址，只包含协议和主机名，Civitai官方的下载地址会被替换为这里配置的地址。
+	DownloadHosts []string `yaml:"download_hosts,omitempty" json:"downloadHosts"`
+	// 允许接收API密钥的镜像或者缓存代理的主机名。API密钥默认只发送给Civitai官方域名，
+	// 只有在这里明确列出、并且在上面配置为https地址的主机才会收到API密钥。
+	APIKeyHosts []string `yaml:"api_key_hosts,omitempty" json:"apiKeyHosts"`
+}
+
+// Civitai访问地址的配置，提供给前端使用。
+type CivitaiEndpoints struct {
+	APIBases      []string `json:"apiBases"`
+	DownloadHosts []string `json:"downloadHosts"`
+	APIKeyHosts   []string `json:"apiKeyHosts"`
+}
+
+func (c *CivitaiConfig) GetAPIKey() string {
+	if c == nil || c.APIKey == nil {
+		return ""
+	}
+	deciphered, err := spiral.Decrypt(*c.APIKey)
+	if err != nil {
+		return ""
+	}
+	return deciphered
+}
+
+func (c *CivitaiConfig) SetAPIKey(plainKey string) error {
+	if len(plainKey) == 0 {
+		c.APIKey = nil
+		return nil
+	}
+	ciphered, err := spiral.Encrypt(plainKey)
+	if err != nil {
+		return err
+	}
+	c.APIKey = &ciphered
+	return nil
+}
+
+// 获取已经配置的Civitai API密钥，未配置时返回空字符串。
+func CivitaiAPIKey() string {
+	if ApplicationSetup == nil {
+		return ""
+	}
+	return ApplicationSetup.CivitaiConfig.GetAPIKey()
+}
+
+// 整理配置的地址列表，去除空白、末尾的斜线以及重复的地址。地址必须是http或者https地址。
+func normalizeEndpoints(endpoints []string) ([]string, error) {
+	normalized := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+		if len(endpoint) == 0 {
+			continue
+		}
+		parsed, err := url.Parse(endpoint)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+			return nil, fmt.Errorf("无效的访问地址：%s", endpoint)
+		}
+		normalized = append(normalized, endpoint)
+	}
+	return lo.Uniq(normalized), nil
+}
+
+// 按照尝试顺序获取Civitai API地址，第一个地址是首选地址，末尾不带斜线。
+func CivitaiAPIBases() []string {
+	if ApplicationSetup != nil && ApplicationSetup.CivitaiConfig != nil {
+		if bases, err := normalizeEndpoints(ApplicationSetup.CivitaiConfig.APIBases); err == nil && len(bases) > 0 {
+			return bases
+		}
+	}
+	return []string{DefaultCivitaiAPIBase}
+}
+
+// 按照尝试顺序获取模型文件的下载地址，第一个地址是首选地址，末尾不带斜线。
+func CivitaiDownloadHosts() []string {
+	if ApplicationSetup != nil && ApplicationSetup.CivitaiConfig != nil {
+		if hosts, err := normalizeEndpoints(ApplicationSetup.CivitaiConfig.DownloadHosts); err == nil && len(hosts) > 0 {
+			return hosts
+		}
+	}
+	return []string{DefaultCivitaiDownloadHost}
+}
+
+// 整理允许接收API密钥的主机名。每一个主机名都必须属于已配置的https访问地址，以免API密钥以明文发送或者发送给未配置的主机。
+func normalizeAPIKeyHosts(hosts []string, endpoints []string) ([]string, error) {
+	secureHosts := lo.FilterMap(endpoints, func(endpoint string, _ int) (string, bool) {
+		parsed, err := url.Parse(endpoint)
+		return strings.ToLower(parsed.Hostname()), err == nil && parsed.Scheme == "https"
+	})
+	normalized := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if len(host) == 0 {
+			continue
+		}
+		if !lo.Contains(secureHosts, host) {
+			return nil, fmt.Errorf("只能向已配置的https访问地址发送API密钥：%s", host)
+		}
+		normalized = append(normalized, host)
+	}
+	return lo.Uniq(normalized), nil
+}
+
+// 获取允许接收API密钥的镜像或者缓存代理的主机名，不包括Civitai官方域名。
+func CivitaiAPIKeyHosts() []string {
+	if ApplicationSetup == nil || ApplicationSetup.CivitaiConfig == nil {
+		return []string{}
+	}
+	hosts, err := normalizeAPIKeyHosts(ApplicationSetup.CivitaiConfig.APIKeyHosts, append(CivitaiAPIBases(), CivitaiDownloadHosts()...))
+	if err != nil {
+		return []string{}
+	}
+	return hosts
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/mitchellh/go-homedir"
 	"gopkg.in/yaml.v3"
@@ -24,11 +25,24 @@ type Configuration struct {
 	ComfyUIConfig *ComfyUIConfig                  `yaml:"comfy_ui"`
 	ProxyConfig   *ProxyConfig                    `yaml:"proxy"`
 	WebUIConfig   *A111StableDiffusionWebUIConfig `yaml:"a111_web_ui"`
+	// 各类模型使用的文件扩展名，键为模型类型，未配置的模型类型使用默认的扩展名。
+	ModelExtensions map[string][]string `yaml:"model_extensions"`
+	// 读取模型文件时按照存储设备进行调度的配置。
+	IOConfig *IOConfig `yaml:"io"`
+	// 访问Civitai时使用的配置。
+	CivitaiConfig *CivitaiConfig `yaml:"civitai"`
+	// 访问远程服务时HTTP客户端使用的配置。
+	NetworkConfig *NetworkConfig `yaml:"network"`
 }
 
+// 对应的软件没有配置模型路径时返回的错误。
+var ErrModelPathNotConfigured = errors.New("的模型路径尚未配置。")
+
 var (
 	ApplicationSetup *Configuration = nil
 	SettingPath      string
+	changeListeners  = make([]func(), 0)
+	listenerLock     sync.Mutex
 )
 
 func LoadConfiguration() *Configuration {
@@ -58,6 +72,23 @@ func (c *Configuration) Save() error {
 	return nil
 }
 
+// 注册一个在应用配置保存并重新加载之后调用的监听函数，用于让依赖配置内容的功能（例如文件监视、网络代理）及时更新。
+func OnConfigurationChanged(listener func()) {
+	listenerLock.Lock()
+	defer listenerLock.Unlock()
+	changeListeners = append(changeListeners, listener)
+}
+
+func notifyConfigurationChanged() {
+	listenerLock.Lock()
+	listeners := make([]func(), len(changeListeners))
+	copy(listeners, changeListeners)
+	listenerLock.Unlock()
+	for _, listener := range listeners {
+		listener()
+	}
+}
+
 func (c *Configuration) CommonPaths() map[UIName]map[string]string {
 	return map[UIName]map[string]string{
 		WebUI: {
@@ -121,7 +152,7 @@ func MatchSoftware(soft string) UIName {
 
 func GetWebUIModelPath(model string) ([]string, error) {
 	if ApplicationSetup.WebUIConfig == nil {
-		return nil, errors.New("SD WebUI的模型路径尚未配置。")
+		return nil, fmt.Errorf("SD WebUI%w", ErrModelPathNotConfigured)
 	}
 	switch strings.ToLower(model) {
 	case "ckpt":
@@ -131,6 +162,8 @@ func GetWebUIModelPath(model string) ([]string, error) {
 	case "hypernet":
 		return []string{ApplicationSetup.WebUIConfig.Hypernet}, nil
 	case "texture":
+		fallthrough
+	case "embedding":
 		return []string{ApplicationSetup.WebUIConfig.Embedding}, nil
 	case "lora":
 		return []string{ApplicationSetup.WebUIConfig.Lora}, nil
@@ -153,7 +186,7 @@ func GetWebUIModelPath(model string) ([]string, error) {
 
 func GetComfyModelPath(model string) ([]string, error) {
 	if ApplicationSetup.ComfyUIConfig == nil {
-		return nil, errors.New("SD ComfyUI的模型路径尚未配置。")
+		return nil, fmt.Errorf("SD ComfyUI%w", ErrModelPathNotConfigured)
 	}
 	switch strings.ToLower(model) {
 	case "ckpt":
@@ -163,6 +196,8 @@ func GetComfyModelPath(model string) ([]string, error) {
 	case "hypernet":
 		return []string{ApplicationSetup.ComfyUIConfig.Hypernet}, nil
 	case "texture":
+		fallthrough
+	case "embedding":
 		return []string{ApplicationSetup.ComfyUIConfig.Embedding}, nil
 	case "lora":
 		fallthrough
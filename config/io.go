@@ -0,0 +1,51 @@
+package config
+
+// 读取模型文件（计算Hash、扫描文件）时的调度配置。读取任务按照文件所在的存储设备分组，每个设备单独限制同时读取的文件数量。
+type IOConfig struct {
+	RotationalConcurrency int            `yaml:"rotational_concurrency" json:"rotationalConcurrency"`  // 机械硬盘上同时读取的文件数量。
+	SolidStateConcurrency int            `yaml:"solid_state_concurrency" json:"solidStateConcurrency"` // 固态硬盘上同时读取的文件数量。
+	UnknownConcurrency    int            `yaml:"unknown_concurrency" json:"unknownConcurrency"`        // 无法判断类型的设备上同时读取的文件数量，目前只有Linux能够判断设备类型。
+	DeviceConcurrency     map[string]int `yaml:"device_concurrency" json:"deviceConcurrency"`          // 为指定设备单独设置同时读取的文件数量，键为该设备上的任意目录。
+	ReadAheadMB           int            `yaml:"read_ahead_mb" json:"readAheadMB"`                     // 计算Hash时预先读取的数据量，设置为负数时不进行预读。
+}
+
+const (
+	defaultRotationalConcurrency = 1
+	defaultSolidStateConcurrency = 4
+	// 这个应用主要在个人电脑上使用，其中的设备多数是固态硬盘，所以无法判断类型的设备默认按照固态硬盘的并发数量读取。
+	defaultUnknownConcurrency = 4
+	defaultReadAheadMB        = 16
+)
+
+// 获取文件读取调度配置，配置文件中没有设置的项目使用默认值。
+func IOSettings() IOConfig {
+	settings := IOConfig{
+		RotationalConcurrency: defaultRotationalConcurrency,
+		SolidStateConcurrency: defaultSolidStateConcurrency,
+		UnknownConcurrency:    defaultUnknownConcurrency,
+		DeviceConcurrency:     make(map[string]int),
+		ReadAheadMB:           defaultReadAheadMB,
+	}
+	if ApplicationSetup == nil || ApplicationSetup.IOConfig == nil {
+		return settings
+	}
+	configured := ApplicationSetup.IOConfig
+	if configured.RotationalConcurrency > 0 {
+		settings.RotationalConcurrency = configured.RotationalConcurrency
+	}
+	if configured.SolidStateConcurrency > 0 {
+		settings.SolidStateConcurrency = configured.SolidStateConcurrency
+	}
+	if configured.UnknownConcurrency > 0 {
+		settings.UnknownConcurrency = configured.UnknownConcurrency
+	}
+	for dir, concurrency := range configured.DeviceConcurrency {
+		if len(dir) > 0 && concurrency > 0 {
+			settings.DeviceConcurrency[dir] = concurrency
+		}
+	}
+	if configured.ReadAheadMB != 0 {
+		settings.ReadAheadMB = configured.ReadAheadMB
+	}
+	return settings
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// 各类模型默认使用的文件扩展名，配置文件中没有为某类模型配置扩展名时使用。
+// 早期版本对全部类型的模型都使用.safetensors、.pt、.pth和.pickle，所以每个类型都保留了这些扩展名，以免已有的文件不再被列出。
+var defaultModelExtensions = map[string][]string{
+	"checkpoint": {".safetensors", ".sft", ".ckpt", ".pt", ".pth", ".pickle", ".bin", ".gguf"},
+	"hypernet":   {".pt", ".pth", ".pickle", ".safetensors"},
+	"embedding":  {".safetensors", ".pt", ".pth", ".pickle", ".bin"},
+	"lora":       {".safetensors", ".sft", ".pt", ".pth", ".pickle", ".ckpt"},
+	"locon":      {".safetensors", ".sft", ".pt", ".pth", ".pickle", ".ckpt"},
+	"vae":        {".safetensors", ".sft", ".pt", ".pth", ".pickle", ".ckpt", ".bin"},
+	"controlnet": {".safetensors", ".sft", ".pth", ".pt", ".pickle", ".ckpt", ".bin"},
+	"upscaler":   {".pth", ".pt", ".pickle", ".safetensors"},
+}
+
+// 将列举模型时使用的模型类型别名转换为配置中使用的模型类型名称。
+func normalizeModelType(modelType string) string {
+	switch strings.ToLower(modelType) {
+	case "ckpt":
+		return "checkpoint"
+	case "texture":
+		return "embedding"
+	default:
+		return strings.ToLower(modelType)
+	}
+}
+
+// 扩展名统一使用带点的小写形式。
+func normalizeExtensions(exts []string) []string {
+	return lo.Uniq(lo.FilterMap(exts, func(ext string, _ int) (string, bool) {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if len(ext) == 0 {
+			return "", false
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		return ext, true
+	}))
+}
+
+// 获取全部模型类型的扩展名配置，配置文件中的配置会覆盖默认配置。
+func ModelExtensions() map[string][]string {
+	extensions := make(map[string][]string, len(defaultModelExtensions))
+	for modelType, exts := range defaultModelExtensions {
+		extensions[modelType] = exts
+	}
+	if ApplicationSetup != nil {
+		for modelType, exts := range ApplicationSetup.ModelExtensions {
+			if normalized := normalizeExtensions(exts); len(normalized) > 0 {
+				extensions[normalizeModelType(modelType)] = normalized
+			}
+		}
+	}
+	return extensions
+}
+
+// 获取指定类型模型的文件扩展名，未知的模型类型将使用全部模型类型的扩展名。
+func GetModelExtensions(modelType string) []string {
+	extensions := ModelExtensions()
+	if exts, ok := extensions[normalizeModelType(modelType)]; ok {
+		return exts
+	}
+	return AllModelExtensions()
+}
+
+// 获取全部模型类型所使用的文件扩展名。
+func AllModelExtensions() []string {
+	return lo.Uniq(lo.Flatten(lo.Values(ModelExtensions())))
+}
+
+// 判断给定的扩展名是否是指定类型模型的文件扩展名，扩展名不区分大小写。
+func IsModelExtension(modelType, ext string) bool {
+	return lo.Contains(GetModelExtensions(modelType), strings.ToLower(ext))
+}
@@ -0,0 +1,45 @@
+package config
+
+// 访问远程服务时HTTP客户端使用的配置。
+type NetworkConfig struct {
+	ConnectTimeoutSeconds int `yaml:"connect_timeout_seconds" json:"connectTimeoutSeconds"` // 建立连接（包括TLS握手）的超时时间。
+	ReadTimeoutSeconds    int `yaml:"read_timeout_seconds" json:"readTimeoutSeconds"`       // 等待响应头以及读取响应内容时两次收到数据之间的超时时间。
+	MaxRetries            int `yaml:"max_retries" json:"maxRetries"`                        // 网络错误或者服务端暂时不可用时的最大重试次数，设置为负数时不进行重试。
+	MaxResponseMB         int `yaml:"max_response_mb" json:"maxResponseMB"`                 // 模型信息、图片等响应内容的最大数据量，不限制模型文件的下载。
+}
+
+const (
+	defaultConnectTimeoutSeconds = 15
+	defaultReadTimeoutSeconds    = 60
+	defaultMaxRetries            = 3
+	defaultMaxResponseMB         = 64
+)
+
+// 获取HTTP客户端配置，配置文件中没有设置的项目使用默认值。
+func NetworkSettings() NetworkConfig {
+	settings := NetworkConfig{
+		ConnectTimeoutSeconds: defaultConnectTimeoutSeconds,
+		ReadTimeoutSeconds:    defaultReadTimeoutSeconds,
+		MaxRetries:            defaultMaxRetries,
+		MaxResponseMB:         defaultMaxResponseMB,
+	}
+	if ApplicationSetup == nil || ApplicationSetup.NetworkConfig == nil {
+		return settings
+	}
+	configured := ApplicationSetup.NetworkConfig
+	if configured.ConnectTimeoutSeconds > 0 {
+		settings.ConnectTimeoutSeconds = configured.ConnectTimeoutSeconds
+	}
+	if configured.ReadTimeoutSeconds > 0 {
+		settings.ReadTimeoutSeconds = configured.ReadTimeoutSeconds
+	}
+	if configured.MaxRetries > 0 {
+		settings.MaxRetries = configured.MaxRetries
+	} else if configured.MaxRetries < 0 {
+		settings.MaxRetries = 0
+	}
+	if configured.MaxResponseMB > 0 {
+		settings.MaxResponseMB = configured.MaxResponseMB
+	}
+	return settings
+}
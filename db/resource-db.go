@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"path/filepath"
 
 	"github.com/glebarez/sqlite"
@@ -14,6 +15,39 @@ type dbConnection string
 
 const DBConnection dbConnection = "db"
 
+// 全文检索使用的FTS5虚拟表，每一个文件缓存记录对应一行，由models包负责维护其内容。
+const FileSearchTable = "file_search_index"
+
+const fileSearchSchema = "CREATE VIRTUAL TABLE IF NOT EXISTS " + FileSearchTable +
+	" USING fts5(file_id UNINDEXED, name, description, tags, prompts, memo, base, tokenize = 'unicode61 remove_diacritics 2')"
+
+// 数据库结构版本，记录在SQLite的user_version中，用于执行只能进行一次的数据迁移。
+const schemaVersion = 1
+
+// 早期版本将CRC32按照小端序记录，而Civitai使用的是大端序（即通常的`%08X`形式），需要把旧记录的字节顺序翻转过来。
+// 旧记录不包含BLAKE3，以此区分新旧记录。
+const normalizeLegacyCRC32 = "UPDATE file_caches SET crc32 = substr(crc32, 7, 2) || substr(crc32, 5, 2) || substr(crc32, 3, 2) || substr(crc32, 1, 2)" +
+	" WHERE length(crc32) = 8 AND (blake3 IS NULL OR blake3 = '')"
+
+// 执行数据库结构版本升级时需要的数据迁移。
+func migrateData(dbConn *gorm.DB) error {
+	var version int
+	if err := dbConn.Raw("PRAGMA user_version").Scan(&version).Error; err != nil {
+		return err
+	}
+	if version >= schemaVersion {
+		return nil
+	}
+	return dbConn.Transaction(func(tx *gorm.DB) error {
+		if version < 1 {
+			if err := tx.Exec(normalizeLegacyCRC32).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)).Error
+	})
+}
+
 func InitDB(ctx *context.Context) error {
 	dbPath := filepath.Join(config.SettingPath, "sdres.db")
 	CacheDB, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
@@ -29,7 +63,17 @@ func InitDB(ctx *context.Context) error {
 		&entities.ModelFile{},
 		&entities.Image{},
 		&entities.FileCache{},
+		&entities.FileMetadata{},
+		&entities.ScanPlan{},
+		&entities.ScanPlanItem{},
+		&entities.RemoteSearchPage{},
 	)
+	if err := CacheDB.Exec(fileSearchSchema).Error; err != nil {
+		return err
+	}
+	if err := migrateData(CacheDB); err != nil {
+		return err
+	}
 	*ctx = context.WithValue(*ctx, DBConnection, CacheDB)
 	return nil
 }
@@ -1,5 +1,11 @@
 package entities
 
+// 根据模型文件内容推断模型类型和基础模型时的可信程度。
+const (
+	InferenceConfidenceHigh = "high"
+	InferenceConfidenceLow  = "low"
+)
+
 type FileCache struct {
 	CommonFields
 	Id                    string        `gorm:"primaryKey;type:text" json:"id"`
@@ -8,15 +14,44 @@ type FileCache struct {
 	FileName              string        `gorm:"type:text" json:"fileName"`
 	ThumbnailPath         *string       `gorm:"type:text" json:"thumbnailPath"`
 	ThumbnailPHash        *string       `gorm:"type:text" json:"thumbnailPHash"`
-	CivitaiInfoPath       *string       `gorm:"type:text" json:"infoPath"`    // 如果本项目不为空，那么模型一定存在详细信息。
-	Size                  uint64        `gorm:"type:integer" json:"fileSize"` // 字节数量
-	CRC32                 string        `gorm:"type:text" json:"crc"`         // 注意位序，这里似乎应该是使用小端序
+	CivitaiInfoPath       *string       `gorm:"type:text" json:"infoPath"`                   // 如果本项目不为空，那么模型一定存在详细信息。
+	Size                  uint64        `gorm:"type:integer" json:"fileSize"`                // 字节数量
+	CRC32                 string        `gorm:"type:text" json:"crc"`                        // CRC32校验值按照大端序的大写Hex形式，与Civitai提供的CRC32格式一致。
+	AutoV1                string        `gorm:"type:text;index:auto_v1_index" json:"autoV1"` // A1111早期使用的模型Hash，大写Hex形式。
+	AutoV2                string        `gorm:"type:text;index:auto_v2_index" json:"autoV2"` // SHA256值的前10位，A1111在生成信息中使用的模型Hash。
+	Blake3                string        `gorm:"type:text" json:"blake3"`
+	Format                string        `gorm:"type:text" json:"format"`                         // 根据文件内容判断的容器格式，例如safetensors、torch-zip、pickle、gguf。
+	PickleVerdict         *string       `gorm:"type:text" json:"pickleVerdict"`                  // 本地pickle安全检查的结论，取值为safe、suspicious、dangerous，不是PyTorch格式的文件为空。
+	PickleFindings        []string      `gorm:"type:text;serializer:json" json:"pickleFindings"` // pickle安全检查中发现的危险或者可疑对象。
+	FileModTime           int64         `gorm:"type:integer" json:"fileModTime"`                 // 文件最后修改时间的Unix纳秒时间戳，与文件大小、Inode和设备编号共同组成文件指纹。
+	FileInode             int64         `gorm:"type:integer" json:"-"`
+	FileDevice            int64         `gorm:"type:integer" json:"-"`
+	UserMetaModTime       int64         `gorm:"type:integer" json:"-"` // 最后一次同步的SD WebUI用户信息文件的修改时间，用于判断用户信息文件是否在SD WebUI中被修改过。
+	ClassifiedModTime     int64         `gorm:"type:integer" json:"-"` // 最后一次根据文件内容推断模型类型时文件的修改时间，文件没有变化时不再重复推断。
 	Memo                  *string       `gorm:"type:text" json:"memo"`
 	AdditionalPrompts     []string      `gorm:"type:text;serializer:json" json:"additionalPrompts"`
-	BaseModel             *string       `gorm:"type:text" json:"baseModel"` // 这一项仅在文件不对应任何模型的时候才器作用，仅作为记录功能使用。
+	BaseModel             *string       `gorm:"type:text" json:"baseModel"`           // 这一项仅在文件不对应任何模型的时候才器作用，仅作为记录功能使用。
+	BaseModelConfidence   *string       `gorm:"type:text" json:"baseModelConfidence"` // 基础模型由文件内容推断得出时的可信程度，用户手动记录的基础模型此项为空。
+	ModelType             *string       `gorm:"type:text" json:"modelType"`           // 使用Civitai的模型类型名称，同样仅在文件不对应任何模型的时候起作用。
+	ModelTypeConfidence   *string       `gorm:"type:text" json:"modelTypeConfidence"` // 模型类型由文件内容推断得出时的可信程度，用户手动记录的模型类型此项为空。
 	RelatedModelFile      *ModelFile    `gorm:"foreignKey:FileIdentityHash;references:IdentityHash" json:"-"`
 	RelatedModelVersionId *int          `gorm:"type:integer;index:model_version_index" json:"relatedModelVersionId"`
 	RelatedModel          *ModelVersion `gorm:"foreignKey:RelatedModelVersionId;references:Id" json:"relatedModel"`
+	Metadata              *FileMetadata `gorm:"foreignKey:FileId;references:Id" json:"-"`
+}
+
+// 从模型文件（目前只有Safetensors文件）文件头中提取的内嵌元数据，其中常用的训练参数会被单独提取出来。
+type FileMetadata struct {
+	CommonFields
+	FileId           string                    `gorm:"primaryKey;type:text" json:"fileId"`
+	BaseModelVersion *string                   `gorm:"type:text" json:"baseModelVersion"` // ss_base_model_version
+	NetworkModule    *string                   `gorm:"type:text" json:"networkModule"`    // ss_network_module
+	NetworkDim       *string                   `gorm:"type:text" json:"networkDim"`       // ss_network_dim
+	NetworkAlpha     *string                   `gorm:"type:text" json:"networkAlpha"`     // ss_network_alpha
+	Architecture     *string                   `gorm:"type:text" json:"architecture"`     // modelspec.architecture
+	Title            *string                   `gorm:"type:text" json:"title"`            // modelspec.title
+	TagFrequency     map[string]map[string]int `gorm:"type:text;serializer:json" json:"tagFrequency"`
+	Raw              map[string]string         `gorm:"type:text;serializer:json" json:"raw"`
 }
 
 type ModelFileMeta struct {
@@ -22,6 +22,10 @@ type Model struct {
 	Tags                    []ModelTags     `gorm:"foreignKey:ModelId;references:Id" json:"tags"`
 	Versions                []ModelVersion  `gorm:"foreignKey:ModelId;references:Id" json:"versions"`
 	CivitailDeleted         bool            `gorm:"type:boolean;default:false" json:"civitaiDeleted"`
+	AllowNoCredit           *bool           `gorm:"type:boolean" json:"allowNoCredit"`                   // 以下为Civitai上模型作者设置的许可权限，更早缓存的模型信息中为空，表示未知。
+	AllowCommercialUse      []string        `gorm:"type:text;serializer:json" json:"allowCommercialUse"` // 取值为None、Image、RentCivit、Rent、Sell。
+	AllowDerivatives        *bool           `gorm:"type:boolean" json:"allowDerivatives"`
+	AllowDifferentLicense   *bool           `gorm:"type:boolean" json:"allowDifferentLicense"`
 }
 
 type ModelVersion struct {
@@ -45,6 +49,9 @@ type ModelVersion struct {
 	CivitaiOriginalResponse []byte      `gorm:"type:blob" json:"-"`
 	CivitaiCreatedAt        *time.Time  `gorm:"type:datetime" json:"civitaiCreatedAt"`
 	CivitaiUpdatedAt        *time.Time  `gorm:"type:datetime" json:"civitaiUpdatedAt"`
+	Rating                  float64     `gorm:"type:real;default:0" json:"rating"`
+	RatingCount             int         `gorm:"type:integer;default:0" json:"ratingCount"`
+	DownloadCount           int         `gorm:"type:integer;default:0" json:"downloadCount"`
 }
 
 type ModelTags struct {
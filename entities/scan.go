@@ -0,0 +1,25 @@
+package entities
+
+const (
+	ScanPlanRunning     = "running"
+	ScanPlanInterrupted = "interrupted"
+)
+
+// 持久化保存的全面扫描计划，用于在应用意外退出之后继续未完成的扫描。
+type ScanPlan struct {
+	CommonFields
+	Id          string         `gorm:"primaryKey;type:text" json:"id"`
+	Kind        string         `gorm:"type:text" json:"kind"`
+	State       string         `gorm:"type:text;index" json:"state"`
+	Directories []string       `gorm:"type:text;serializer:json" json:"directories"`
+	Items       []ScanPlanItem `gorm:"foreignKey:PlanId;references:Id" json:"-"`
+}
+
+type ScanPlanItem struct {
+	Id        int64  `gorm:"primaryKey;type:integer;autoIncrement" json:"id"`
+	PlanId    string `gorm:"type:text;index:plan_item_index" json:"planId"`
+	ModelType string `gorm:"type:text" json:"modelType"`
+	FullPath  string `gorm:"type:text" json:"fullPath"`
+	Size      int64  `gorm:"type:integer" json:"size"`
+	Done      bool   `gorm:"type:boolean;default:false;index:plan_item_index" json:"done"`
+}
@@ -0,0 +1,12 @@
+package entities
+
+import "time"
+
+// 缓存的Civitai模型搜索结果页，用于翻页返回以及无法访问Civitai时浏览之前的搜索结果。
+type RemoteSearchPage struct {
+	CommonFields
+	Id        string    `gorm:"primaryKey;type:text" json:"id"` // 搜索条件的摘要。
+	Query     string    `gorm:"type:text" json:"query"`         // 搜索条件组成的查询字符串。
+	Response  []byte    `gorm:"type:blob" json:"-"`
+	FetchedAt time.Time `gorm:"type:datetime;index" json:"fetchedAt"`
+}
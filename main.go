@@ -83,6 +83,9 @@ func main() {
 			remoteController.SetContext(ctx)
 			gitController.SetContext(ctx)
 		},
+		OnShutdown: func(ctx context.Context) {
+			modelController.StopFileWatcher()
+		},
 		Bind: []interface{}{
 			app,
 			settings,
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -65,15 +66,40 @@ type ModelVersion struct {
 	Images       []ModelImage          `json:"images"`
 }
 
+// Civitai早期使用单个字符串表示允许的商业用途，现在使用字符串数组，两种形式都会被转换为数组。
+type CommercialUsePermissions []string
+
+func (p *CommercialUsePermissions) UnmarshalJSON(data []byte) error {
+	var single *string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single == nil {
+			*p = nil
+		} else {
+			*p = CommercialUsePermissions{*single}
+		}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*p = multiple
+	return nil
+}
+
 type Model struct {
-	Id            int            `json:"id"`
-	Name          string         `json:"name"`
-	Description   *string        `json:"description"`
-	Type          string         `json:"type"`
-	NSFW          bool           `json:"nsfw"`
-	POI           bool           `json:"poi"`
-	Tags          []string       `json:"tags"`
-	Mode          *string        `json:"mode"`
-	Creator       CivitaiCreator `json:"creator"`
-	ModelVersions []ModelVersion `json:"modelVersions"`
+	Id                    int                      `json:"id"`
+	Name                  string                   `json:"name"`
+	Description           *string                  `json:"description"`
+	Type                  string                   `json:"type"`
+	NSFW                  bool                     `json:"nsfw"`
+	POI                   bool                     `json:"poi"`
+	Tags                  []string                 `json:"tags"`
+	Mode                  *string                  `json:"mode"`
+	Creator               CivitaiCreator           `json:"creator"`
+	ModelVersions         []ModelVersion           `json:"modelVersions"`
+	AllowNoCredit         *bool                    `json:"allowNoCredit"`
+	AllowCommercialUse    CommercialUsePermissions `json:"allowCommercialUse"`
+	AllowDerivatives      *bool                    `json:"allowDerivatives"`
+	AllowDifferentLicense *bool                    `json:"allowDifferentLicense"`
 }
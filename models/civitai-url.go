@@ -2,26 +2,45 @@ package models
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
+
+	"github.com/vixalie/sd-content-manager/config"
 )
 
+// 以下函数使用配置的首选API地址组装访问地址，其他备用地址由`Remote`包在访问失败时依次尝试。
+
 func AssembleModelVersionUrl(versionId int) string {
 	builder := strings.Builder{}
-	builder.WriteString("https://civitai.com/api/v1/model-versions/")
+	builder.WriteString(config.CivitaiAPIBases()[0])
+	builder.WriteString("/model-versions/")
 	builder.WriteString(fmt.Sprintf("%d", versionId))
 	return builder.String()
 }
 
 func AssembleModelUrl(modelId int) string {
 	builder := strings.Builder{}
-	builder.WriteString("https://civitai.com/api/v1/models/")
+	builder.WriteString(config.CivitaiAPIBases()[0])
+	builder.WriteString("/models/")
 	builder.WriteString(fmt.Sprintf("%d", modelId))
 	return builder.String()
 }
 
 func AssembleModelVersionByHashUrl(hash string) string {
 	builder := strings.Builder{}
-	builder.WriteString("https://civitai.com/api/v1/model-versions/by-hash/")
+	builder.WriteString(config.CivitaiAPIBases()[0])
+	builder.WriteString("/model-versions/by-hash/")
 	builder.WriteString(hash)
 	return builder.String()
 }
+
+func AssembleModelSearchUrl(query url.Values) string {
+	builder := strings.Builder{}
+	builder.WriteString(config.CivitaiAPIBases()[0])
+	builder.WriteString("/models")
+	if len(query) > 0 {
+		builder.WriteString("?")
+		builder.WriteString(query.Encode())
+	}
+	return builder.String()
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/config"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"gorm.io/gorm"
+)
+
+// 模型陪同文件的用途。
+const (
+	CompanionThumbnail   = "thumbnail"    // 缩略图，name.png或者name.preview.png等。
+	CompanionCivitaiInfo = "civitai-info" // Civitai Helper生成的模型信息，name.civitai.info。
+	CompanionUserMeta    = "user-meta"    // SD WebUI中用户编辑的模型信息，name.json。
+	CompanionDescription = "description"  // 模型说明，name.txt。
+	CompanionConfig      = "config"       // 模型配置，name.yaml。
+	CompanionVAE         = "vae"          // 与模型配套的VAE，name.vae.pt等。
+)
+
+type companionConvention struct {
+	Role   string
+	Suffix string
+}
+
+// 各种陪同文件的命名约定，文件名必须与模型文件去掉扩展名之后的名称加上后缀完全一致（不区分大小写）。
+// 同一用途的多个约定按照优先顺序排列，缩略图的顺序与SD WebUI查找预览图的顺序一致。
+var companionConventions = []companionConvention{
+	{CompanionThumbnail, ".png"},
+	{CompanionThumbnail, ".preview.png"},
+	{CompanionThumbnail, ".jpg"},
+	{CompanionThumbnail, ".preview.jpg"},
+	{CompanionThumbnail, ".jpeg"},
+	{CompanionThumbnail, ".preview.jpeg"},
+	{CompanionThumbnail, ".webp"},
+	{CompanionThumbnail, ".preview.webp"},
+	{CompanionCivitaiInfo, ".civitai.info"},
+	{CompanionUserMeta, ".json"},
+	{CompanionDescription, ".txt"},
+	{CompanionConfig, ".yaml"},
+	{CompanionVAE, ".vae.pt"},
+	{CompanionVAE, ".vae.ckpt"},
+	{CompanionVAE, ".vae.safetensors"},
+}
+
+// 无法确定唯一陪同文件的情况。Role为空表示同一目录中存在其他同名的模型文件，全部陪同文件都可能属于其他模型文件。
+type CompanionAmbiguity struct {
+	Role       string   `json:"role"`
+	Reason     string   `json:"reason"`
+	Candidates []string `json:"candidates"`
+}
+
+type ModelCompanions struct {
+	ModelPath   string               `json:"modelPath"`
+	Files       map[string][]string  `json:"files"` // 以用途为键，同一用途的多个文件按照命名约定的优先顺序排列。
+	Ambiguities []CompanionAmbiguity `json:"ambiguities"`
+}
+
+// 获取指定用途优先级最高的陪同文件。
+func (c *ModelCompanions) primary(role string) *string {
+	files := c.Files[role]
+	if len(files) == 0 {
+		return nil
+	}
+	return lo.ToPtr(files[0])
+}
+
+// 按照已知的命名约定精确匹配模型文件的全部陪同文件。同一用途存在多个文件，或者目录中存在其他同名的模型文件时，
+// 不会丢弃任何候选文件，而是记录为无法确定的情况。
+func matchCompanionFiles(modelFilePath string) (*ModelCompanions, error) {
+	modelFile, err := os.Stat(modelFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("模型文件不存在")
+		}
+		return nil, fmt.Errorf("获取模型文件信息出错，%w", err)
+	}
+	modelDir := filepath.Dir(modelFilePath)
+	modelFileName := modelFile.Name()
+	modelExt := filepath.Ext(modelFileName)
+	baseName := strings.ToLower(strings.TrimSuffix(modelFileName, modelExt))
+	entries, err := os.ReadDir(modelDir)
+	if err != nil {
+		return nil, fmt.Errorf("获取模型文件所在目录文件列表出错，%w", err)
+	}
+	companions := &ModelCompanions{
+		ModelPath:   modelFilePath,
+		Files:       make(map[string][]string),
+		Ambiguities: make([]CompanionAmbiguity, 0),
+	}
+	entryByName := make(map[string][]string)
+	siblingModels := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == modelFileName {
+			continue
+		}
+		lowerName := strings.ToLower(entry.Name())
+		entryPath := filepath.Join(modelDir, entry.Name())
+		// 仅大小写不同的多个文件中，与模型文件名称大小写一致的文件优先。
+		if strings.HasPrefix(entry.Name(), strings.TrimSuffix(modelFileName, modelExt)) {
+			entryByName[lowerName] = append([]string{entryPath}, entryByName[lowerName]...)
+		} else {
+			entryByName[lowerName] = append(entryByName[lowerName], entryPath)
+		}
+		ext := filepath.Ext(lowerName)
+		if strings.TrimSuffix(lowerName, ext) == baseName && config.IsModelExtension("", ext) {
+			siblingModels = append(siblingModels, filepath.Join(modelDir, entry.Name()))
+		}
+	}
+	for _, convention := range companionConventions {
+		// 在区分大小写的文件系统中，仅大小写不同的多个文件都会被收集。
+		companions.Files[convention.Role] = append(companions.Files[convention.Role], entryByName[baseName+convention.Suffix]...)
+	}
+	for _, convention := range lo.UniqBy(companionConventions, func(c companionConvention) string { return c.Role }) {
+		if files := companions.Files[convention.Role]; len(files) > 1 {
+			companions.Ambiguities = append(companions.Ambiguities, CompanionAmbiguity{
+				Role:       convention.Role,
+				Reason:     "存在多个相同用途的陪同文件",
+				Candidates: files,
+			})
+		}
+		if len(companions.Files[convention.Role]) == 0 {
+			delete(companions.Files, convention.Role)
+		}
+	}
+	if len(siblingModels) > 0 {
+		companions.Ambiguities = append(companions.Ambiguities, CompanionAmbiguity{
+			Reason:     "同一目录中存在其他同名的模型文件，陪同文件可能属于其他模型文件",
+			Candidates: siblingModels,
+		})
+	}
+	return companions, nil
+}
+
+// 获取指定文件记录对应模型文件的全部陪同文件。
+func fetchCompanionFiles(ctx context.Context, fileId string) (*ModelCompanions, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var file entities.FileCache
+	if result := dbConn.Where("id = ?", fileId).First(&file); result.Error != nil {
+		return nil, fmt.Errorf("未找到指定的文件记录，%w", result.Error)
+	}
+	return matchCompanionFiles(file.FullPath)
+}
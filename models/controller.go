@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/vixalie/sd-content-manager/config"
 	"github.com/vixalie/sd-content-manager/db"
@@ -20,12 +21,47 @@ type ModelController struct {
 	ctx context.Context
 }
 
+// 配置变更的监听只需要登记一次，避免重复调用SetContext时重复登记。
+var configListenerOnce sync.Once
+
 func NewModelController() *ModelController {
 	return &ModelController{}
 }
 
 func (m *ModelController) SetContext(ctx context.Context) {
 	m.ctx = ctx
+	// 上次运行时没有完成的扫描计划都需要标记为被中断，等待用户选择继续或者放弃。
+	if err := markInterruptedScanPlans(ctx); err != nil {
+		runtime.LogErrorf(ctx, "标记被中断的扫描计划失败，%s", err)
+	}
+	configListenerOnce.Do(func() {
+		// 模型目录配置发生变化之后，需要重新建立模型目录监视。
+		config.OnConfigurationChanged(func() {
+			if err := refreshModelFileWatcher(ctx); err != nil {
+				runtime.LogErrorf(ctx, "重新启动模型目录监视失败，%s", err)
+			}
+		})
+		// 文件读取调度配置变化之后，需要重新确定每个存储设备的并发读取数量。
+		config.OnConfigurationChanged(fileIOScheduler.reset)
+	})
+	go func() {
+		if err := startModelFileWatcher(ctx); err != nil {
+			runtime.LogErrorf(ctx, "启动模型目录监视失败，%s", err)
+		}
+	}()
+	go backfillModelVersionStats(ctx)
+	go ensureSearchIndex(ctx)
+	go backfillModelLicenses(ctx)
+}
+
+// 手动重新启动模型目录监视。
+func (m ModelController) RestartFileWatcher() error {
+	return startModelFileWatcher(m.ctx)
+}
+
+// 停止模型目录监视，应用退出时也需要调用。
+func (m ModelController) StopFileWatcher() {
+	stopModelFileWatcher()
 }
 
 func (m ModelController) GetModelSubCategoryDirs(software, model string) ([]string, error) {
@@ -36,10 +72,57 @@ func (m ModelController) ListModelFiles(software, model, subdir, keyword string)
 	return scanModelFiles(m.ctx, software, model, subdir, keyword)
 }
 
+// 分页列举模型文件，可以包含全部子目录，并按照名称、大小、添加时间、基础模型或者Civitai评分排序。
+// 查询完全在数据库中进行，需要扫描目录中新增的文件时，将查询条件中的`refresh`设为true。
+func (m ModelController) ListModelFilesPaged(query ModelFileQuery) (*ModelFilePage, error) {
+	return queryModelFiles(m.ctx, query)
+}
+
+// 使用全文检索在模型名称、描述、标签、提示词、备注和基础模型中查找本地模型文件。
+func (m ModelController) SearchModelFiles(query string, page, pageSize int) (*ModelFilePage, error) {
+	return searchModelFiles(m.ctx, query, page, pageSize)
+}
+
+func (m ModelController) RebuildSearchIndex() error {
+	return rebuildSearchIndex(m.ctx)
+}
+
+// 获取模型文件按照用途分类的全部陪同文件，以及无法确定唯一陪同文件的情况。
+func (m ModelController) FetchCompanionFiles(fileId string) (*ModelCompanions, error) {
+	return fetchCompanionFiles(m.ctx, fileId)
+}
+
+func (m ModelController) ScanOrphanCompanions() *OrphanCompanionReport {
+	return scanOrphanCompanions(m.ctx)
+}
+
+func (m ModelController) CleanupOrphanCompanions(dryRun, includeUncertain bool) *OrphanCleanupResult {
+	return cleanupOrphanCompanions(m.ctx, dryRun, includeUncertain)
+}
+
+func (m ModelController) AnalyzeDiskUsage(largestLimit int) (*DiskUsageReport, error) {
+	return analyzeDiskUsage(m.ctx, largestLimit)
+}
+
+// 重新对PyTorch格式的模型文件进行pickle安全检查，返回检查中发现的全部引用对象。
+func (m ModelController) ScanFilePickleSafety(fileId string) (*utils.PickleScanResult, error) {
+	return rescanFilePickle(m.ctx, fileId)
+}
+
+// 按照基础模型、模型类型、NSFW等级、标签、作者、文件大小等多个维度筛选本地模型文件，同时返回各维度的统计数量。
+func (m ModelController) FilterModelFiles(filter ModelFileFilter) (*ModelFilterResult, error) {
+	return filterModelFiles(m.ctx, filter)
+}
+
 func (m ModelController) FetchUncachedFileInfo(fileId string) (*entities.FileCache, error) {
 	return fetchUncachedFileInfo(m.ctx, fileId)
 }
 
+// 获取模型文件中内嵌的训练元数据，文件中不包含元数据时返回nil。
+func (m ModelController) FetchFileMetadata(fileId string) (*entities.FileMetadata, error) {
+	return fetchFileMetadata(m.ctx, fileId)
+}
+
 func (m ModelController) FetchCachedFileInfo(modelId int) (*entities.ModelVersion, error) {
 	return fetchCachedModelInfo(m.ctx, modelId)
 }
@@ -65,6 +148,15 @@ func (m ModelController) RecordFileBaseModel(fileId, baseModel string) error {
 	return recordCustomBaseModel(m.ctx, fileId, baseModel)
 }
 
+func (m ModelController) RecordFileModelType(fileId, modelType string) error {
+	return recordCustomModelType(m.ctx, fileId, modelType)
+}
+
+// 根据文件内容重新推断模型类型和基础模型，用户手动记录的内容将被覆盖。
+func (m ModelController) ReclassifyModelFile(fileId string) (*entities.FileCache, error) {
+	return reclassifyModelFile(m.ctx, fileId)
+}
+
 func (m ModelController) RecordFileMemo(fileId, memo string) error {
 	return recordModelMemo(m.ctx, fileId, memo)
 }
@@ -136,6 +228,7 @@ func (m ModelController) CopyModelFileLoader(modelVersionId int) error {
 	if err != nil {
 		return err
 	}
+	WarnLicenseRestrictions(m.ctx, modelVersion.Model, LicenseActionCopyPrompt)
 	switch strings.ToLower(modelVersion.Model.Type) {
 	case "lora":
 		runtime.ClipboardSetText(m.ctx, fmt.Sprintf("<lora:%s:1>", fileName))
@@ -159,6 +252,14 @@ func (m ModelController) FetchModelTags(modelId int) ([]string, error) {
 	return fetchModelTags(m.ctx, modelId)
 }
 
+func (m ModelController) FetchModelLicense(modelId int) (*ModelLicense, error) {
+	return fetchModelLicense(m.ctx, modelId)
+}
+
+func (m ModelController) ListModelUpdates() ([]ModelUpdates, error) {
+	return listModelUpdates(m.ctx)
+}
+
 func (m ModelController) IsModelVersionPrimaryFileDownloaded(modelVersionId int) (bool, error) {
 	return checkModelVersionDownloaded(m.ctx, modelVersionId)
 }
@@ -256,30 +357,88 @@ func (m ModelController) CheckModelVersionPrimaryFileSize(modelVersionId int) (u
 	return modelVersion.PrimaryFile.Size, nil
 }
 
+// 给定的Hash可以是SHA256、AutoV2、AutoV1、BLAKE3或者CRC32中的任意一种，以便从A1111生成信息中的短Hash找到对应的模型。
 func (m ModelController) FetchModelInfoByFileHash(fileHash string) (*entities.Model, error) {
-	dbConn := m.ctx.Value(db.DBConnection).(*gorm.DB)
-	var file entities.ModelFile
-	result := dbConn.Joins("Version").Joins("Version.Model").Where("identity_hash = ?", fileHash).First(&file)
-	if result.Error != nil {
-		return nil, fmt.Errorf("未找到给定的Hash对应的模型文件信息，%w", result.Error)
+	file, err := findModelFileByAnyHash(m.ctx, fileHash)
+	if err != nil {
+		return nil, err
 	}
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return nil, nil
+	if file == nil {
+		return nil, fmt.Errorf("未找到给定的Hash对应的模型文件信息")
 	}
 	return file.Version.Model, nil
 }
 
+// 使用任意一种Hash值查找本地文件，未找到时返回nil。
+func (m ModelController) FetchLocalFileByHash(fileHash string) (*entities.FileCache, error) {
+	return findFileCacheByAnyHash(m.ctx, fileHash)
+}
+
 // 本方法用于对全部可管理模型进行全面扫描，将所有的模型信息都记录到数据库中。可能花费时间非常长，使用时注意提供界面进度提示。
+// 扫描过程将作为扫描任务运行，任务的编号和进度会通过`scan-job`事件发送，可以使用任务编号暂停或者取消扫描。
 func (m ModelController) ScanAllResouces() error {
 	return fullScanEverything(m.ctx)
 }
 
 // 本方法用于扫描全部可管理目录中的重复文件，重复文件的判断基于Sha256 Hash值，故不能保证文件一定相同，但可以保证基本与Civitai的判断一致。
-// 本方法中包含大量的文件扫描操作和反复的数据库检索操作，所以会消耗非常长的时间。
+// 本方法中包含大量的文件扫描操作和反复的数据库检索操作，所以会消耗非常长的时间。扫描过程同样作为扫描任务运行。
 func (m ModelController) ScanDuplicateFiles() ([]DuplicateRecord, error) {
 	return scanDuplicateModelFiles(m.ctx)
 }
 
+// 为使用SD WebUI缓存的Hash记录的文件补充CRC32和BLAKE3，需要读取整个文件，所以同样作为扫描任务运行。
+func (m ModelController) ComputeMissingHashes() error {
+	return computeMissingHashes(m.ctx)
+}
+
+// 检查是否存在上次运行时被中断的全面扫描，前端可以据此提示用户继续扫描。不存在被中断的扫描时返回nil。
+func (m ModelController) FetchInterruptedScan() (*InterruptedScan, error) {
+	return fetchInterruptedScan(m.ctx)
+}
+
+// 从中断的位置继续执行指定的全面扫描计划。
+func (m ModelController) ResumeInterruptedScan(planId string) error {
+	return resumeInterruptedScan(m.ctx, planId)
+}
+
+// 放弃被中断的全面扫描，删除其扫描计划。
+func (m ModelController) DiscardInterruptedScan(planId string) error {
+	if err := removeScanPlan(m.ctx, planId); err != nil {
+		return fmt.Errorf("删除扫描计划失败，%w", err)
+	}
+	return nil
+}
+
+// 列出当前登记的全部扫描任务及其进度。
+func (m ModelController) FetchScanJobs() []ScanJobProgress {
+	return listScanJobs()
+}
+
+func (m ModelController) PauseScanJob(jobId string) error {
+	job, err := findScanJob(jobId)
+	if err != nil {
+		return err
+	}
+	return job.Pause()
+}
+
+func (m ModelController) ResumeScanJob(jobId string) error {
+	job, err := findScanJob(jobId)
+	if err != nil {
+		return err
+	}
+	return job.Resume()
+}
+
+// 取消指定的扫描任务，被取消的扫描任务中已经完成的部分会被保留。
+func (m ModelController) CancelScanJob(jobId string) error {
+	job, err := findScanJob(jobId)
+	if err != nil {
+		return err
+	}
+	return job.Cancel()
+}
+
 func (m ModelController) DeleteModelFiles(filePathes []string) error {
 	for _, f := range filePathes {
 		err := deleteModel(m.ctx, f)
@@ -306,11 +465,7 @@ func (m ModelController) CheckUnexistCaches() ([]*entities.FileCache, error) {
 
 func (m ModelController) DeleteCaches(cacheIds []string) error {
 	dbConn := m.ctx.Value(db.DBConnection).(*gorm.DB)
-	result := dbConn.Unscoped().Where("id IN ?", cacheIds).Delete(&entities.FileCache{})
-	if result.Error != nil {
-		return fmt.Errorf("删除缓存文件信息失败，%w", result.Error)
-	}
-	return nil
+	return deleteFileCaches(dbConn, cacheIds...)
 }
 
 type duplicatedFileCache struct {
@@ -333,6 +488,7 @@ func (m ModelController) DeleteInvalidCaches() error {
 		minTimeQuery := dbConn.Model(&entities.FileCache{}).Select("min(created_at) as created_at").Where("file_identity_hash = ?", duplicatedFile.FileIdentityHash)
 		dbConn.Unscoped().Where("file_identity_hash = ? AND created_at != (?)", duplicatedFile.FileIdentityHash, minTimeQuery).Delete(&entities.FileCache{})
 	}
+	logReindexError(m.ctx, pruneSearchIndex(dbConn))
 	return nil
 }
 
@@ -367,6 +523,7 @@ func (m ModelController) CopyTextureInversionEmbeddingPrompts(modelVersionId int
 	if strings.ToLower(modelVersion.Model.Type) != "textualinversion" {
 		return fmt.Errorf("只能用于TextureInversion类型模型")
 	}
+	WarnLicenseRestrictions(m.ctx, modelVersion.Model, LicenseActionCopyPrompt)
 	runtime.ClipboardSetText(m.ctx, fmt.Sprintf("embedding:%s", fileName))
 	return nil
 }
@@ -1,10 +1,14 @@
 package models
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/vixalie/sd-content-manager/config"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 func scanModelSubCategoryDirs(software, model string) ([]string, error) {
@@ -81,3 +85,50 @@ func scanWebUIModelSubDirs(model string) ([]string, error) {
 	}
 	return subCategoryDirs, nil
 }
+
+// 一个已经配置的可管理模型目录。
+type managedModelDir struct {
+	UI        config.UIName
+	ModelType string
+	Path      string
+}
+
+// 列出全部已配置的可管理模型目录，未配置的目录将被忽略，被多个模型类型重复使用的目录只保留首次出现的记录。
+func listManagedModelDirs(ctx context.Context) []managedModelDir {
+	var (
+		dirs    = make([]managedModelDir, 0)
+		visited = make(map[string]bool, 0)
+	)
+	for _, ui := range []config.UIName{config.ComfyUI, config.WebUI} {
+		for _, modelType := range scanableModelTypes {
+			var (
+				targetDirs []string
+				err        error
+			)
+			switch ui {
+			case config.ComfyUI:
+				targetDirs, err = config.GetComfyModelPath(modelType)
+			case config.WebUI:
+				targetDirs, err = config.GetWebUIModelPath(modelType)
+			}
+			if err != nil {
+				if !errors.Is(err, config.ErrModelPathNotConfigured) {
+					runtime.LogWarningf(ctx, "无法获取 [%s] 模型目录，%s", modelType, err)
+				}
+				continue
+			}
+			for _, dir := range targetDirs {
+				if len(dir) == 0 {
+					continue
+				}
+				cleanDir := filepath.Clean(dir)
+				if visited[cleanDir] {
+					continue
+				}
+				visited[cleanDir] = true
+				dirs = append(dirs, managedModelDir{UI: ui, ModelType: modelType, Path: cleanDir})
+			}
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"gorm.io/gorm"
+)
+
+// 无法确定分组时使用的键，例如不在任何已配置模型目录中的文件，或者没有Civitai信息的文件的作者。
+const usageUnknownKey = "unknown"
+
+const (
+	defaultLargestFilesLimit = 20
+	// 作者的数量可能非常多，只返回占用空间最多的部分。
+	maxAuthorUsageBuckets = 50
+)
+
+type UsageBucket struct {
+	Key   string `json:"key"`
+	Files int    `json:"files"`
+	Size  uint64 `json:"size"`
+}
+
+type SubDirUsage struct {
+	UI        string `json:"ui"`
+	ModelType string `json:"modelType"`
+	Path      string `json:"path"`
+	SubDir    string `json:"subdir"` // 模型目录下的第一级子目录，直接位于模型目录中的文件为空。
+	Files     int    `json:"files"`
+	Size      uint64 `json:"size"`
+}
+
+type LargeFileUsage struct {
+	FileId      string  `json:"fileId"`
+	FilePath    string  `json:"filePath"`
+	FileName    string  `json:"fileName"`
+	Size        uint64  `json:"size"`
+	ModelName   *string `json:"modelName"`
+	VersionName *string `json:"versionName"`
+}
+
+// 可以通过删除文件回收的空间。
+type ReclaimableUsage struct {
+	Files int    `json:"files"`
+	Size  uint64 `json:"size"`
+}
+
+// 模型库的磁盘用量，全部分组都按照占用空间从大到小排列。
+type DiskUsageReport struct {
+	TotalFiles   int              `json:"totalFiles"`
+	TotalSize    uint64           `json:"totalSize"`
+	ByUI         []UsageBucket    `json:"byUI"`
+	ByModelType  []UsageBucket    `json:"byModelType"`
+	BySubDir     []SubDirUsage    `json:"bySubDir"`
+	ByBaseModel  []UsageBucket    `json:"byBaseModel"`
+	ByAuthor     []UsageBucket    `json:"byAuthor"`
+	LargestFiles []LargeFileUsage `json:"largestFiles"`
+	// 每组重复文件只保留一个时可以回收的空间。重复文件不会被记录，这里同时使用最近一次重复文件扫描的结果，
+	// 尚未进行过重复文件扫描时DuplicatesScannedAt为空，结果只包含数据库中记录的重复文件。
+	Duplicates          ReclaimableUsage `json:"duplicates"`
+	DuplicatesScannedAt *time.Time       `json:"duplicatesScannedAt"`
+	CivitaiDeleted      ReclaimableUsage `json:"civitaiDeleted"` // 对应的模型已经从Civitai删除的文件。
+}
+
+type fileUsageRow struct {
+	Id               string
+	FullPath         string
+	FileName         string
+	Size             uint64
+	FileIdentityHash string
+	BaseModel        *string
+	Author           *string
+	CivitaiDeleted   bool
+	ModelName        *string
+	VersionName      *string
+}
+
+// 按照键累计文件数量和占用空间。
+type usageAccumulator map[string]*UsageBucket
+
+func (a usageAccumulator) add(key string, size uint64) {
+	bucket, ok := a[key]
+	if !ok {
+		bucket = &UsageBucket{Key: key}
+		a[key] = bucket
+	}
+	bucket.Files++
+	bucket.Size += size
+}
+
+func (a usageAccumulator) sorted(limit int) []UsageBucket {
+	buckets := lo.Map(lo.Values(a), func(bucket *UsageBucket, _ int) UsageBucket {
+		return *bucket
+	})
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Size == buckets[j].Size {
+			return buckets[i].Key < buckets[j].Key
+		}
+		return buckets[i].Size > buckets[j].Size
+	})
+	if limit > 0 && len(buckets) > limit {
+		buckets = buckets[:limit]
+	}
+	return buckets
+}
+
+// 查找文件所在的已配置模型目录，目录之间存在嵌套时使用最深的目录。
+func locateManagedDir(dirs []managedModelDir, filePath string) (*managedModelDir, string) {
+	var (
+		matched *managedModelDir
+		subDir  string
+	)
+	for i := range dirs {
+		prefix := dirs[i].Path + string(filepath.Separator)
+		if !strings.HasPrefix(filePath, prefix) || (matched != nil && len(dirs[i].Path) <= len(matched.Path)) {
+			continue
+		}
+		matched = &dirs[i]
+		subDir = ""
+		if relative := strings.TrimPrefix(filepath.Dir(filePath), dirs[i].Path); len(relative) > 0 {
+			subDir = strings.Split(strings.TrimPrefix(relative, string(filepath.Separator)), string(filepath.Separator))[0]
+		}
+	}
+	return matched, subDir
+}
+
+// 计算重复文件可以回收的空间，每组重复文件保留占用空间最大的一个。
+func computeDuplicateUsage(rows []fileUsageRow) (ReclaimableUsage, *time.Time) {
+	groups := make(map[string]map[string]uint64)
+	addFile := func(hash, path string, size uint64) {
+		hash = strings.ToUpper(hash)
+		if _, ok := groups[hash]; !ok {
+			groups[hash] = make(map[string]uint64)
+		}
+		groups[hash][path] = size
+	}
+	for _, row := range rows {
+		if len(row.FileIdentityHash) > 0 {
+			addFile(row.FileIdentityHash, row.FullPath, row.Size)
+		}
+	}
+	lastDuplicateScan.lock.Lock()
+	records, scannedAt := lastDuplicateScan.records, lastDuplicateScan.scannedAt
+	lastDuplicateScan.lock.Unlock()
+	for _, record := range records {
+		for _, file := range record.Files {
+			// 扫描之后已经被删除的文件不再计算。
+			if info, err := os.Stat(file.FilePath); err == nil {
+				addFile(record.Hash, file.FilePath, uint64(info.Size()))
+			}
+		}
+	}
+	var usage ReclaimableUsage
+	for _, files := range groups {
+		if len(files) < 2 {
+			continue
+		}
+		sizes := lo.Values(files)
+		usage.Files += len(sizes) - 1
+		usage.Size += lo.SumBy(sizes, func(size uint64) uint64 { return size }) - lo.Max(sizes)
+	}
+	return usage, scannedAt
+}
+
+// 汇总全部已记录模型文件的磁盘用量。largestLimit指定返回的最大文件数量，不大于0时使用默认数量。
+func analyzeDiskUsage(ctx context.Context, largestLimit int) (*DiskUsageReport, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	if largestLimit <= 0 {
+		largestLimit = defaultLargestFilesLimit
+	}
+	var rows []fileUsageRow
+	result := dbConn.Model(&entities.FileCache{}).
+		Joins(relatedVersionJoin).
+		Joins(relatedModelJoin).
+		Select(fmt.Sprintf("file_caches.id, file_caches.full_path, file_caches.file_name, file_caches.size, file_caches.file_identity_hash, "+
+			"%s AS base_model, %s AS author, COALESCE(`RelatedModel__Model`.`civitail_deleted`, 0) AS civitai_deleted, "+
+			"`RelatedModel__Model`.`name` AS model_name, `RelatedModel`.`version_name` AS version_name",
+			modelFilterExpressions[facetBaseModel], modelFilterExpressions[facetAuthor])).
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, fmt.Errorf("查询模型文件用量失败，%w", result.Error)
+	}
+	var (
+		report = &DiskUsageReport{
+			ByUI:         make([]UsageBucket, 0),
+			ByModelType:  make([]UsageBucket, 0),
+			BySubDir:     make([]SubDirUsage, 0),
+			ByBaseModel:  make([]UsageBucket, 0),
+			ByAuthor:     make([]UsageBucket, 0),
+			LargestFiles: make([]LargeFileUsage, 0),
+		}
+		managedDirs = listManagedModelDirs(ctx)
+		byUI        = make(usageAccumulator)
+		byModelType = make(usageAccumulator)
+		byBaseModel = make(usageAccumulator)
+		byAuthor    = make(usageAccumulator)
+		bySubDir    = make(map[string]*SubDirUsage)
+	)
+	for _, row := range rows {
+		report.TotalFiles++
+		report.TotalSize += row.Size
+		byBaseModel.add(lo.FromPtrOr(row.BaseModel, usageUnknownKey), row.Size)
+		byAuthor.add(lo.FromPtrOr(row.Author, usageUnknownKey), row.Size)
+		if row.CivitaiDeleted {
+			report.CivitaiDeleted.Files++
+			report.CivitaiDeleted.Size += row.Size
+		}
+		managedDir, subDir := locateManagedDir(managedDirs, row.FullPath)
+		if managedDir == nil {
+			byUI.add(usageUnknownKey, row.Size)
+			byModelType.add(usageUnknownKey, row.Size)
+			continue
+		}
+		byUI.add(string(managedDir.UI), row.Size)
+		byModelType.add(managedDir.ModelType, row.Size)
+		subDirPath := filepath.Join(managedDir.Path, subDir)
+		usage, ok := bySubDir[subDirPath]
+		if !ok {
+			usage = &SubDirUsage{UI: string(managedDir.UI), ModelType: managedDir.ModelType, Path: subDirPath, SubDir: subDir}
+			bySubDir[subDirPath] = usage
+		}
+		usage.Files++
+		usage.Size += row.Size
+	}
+	report.ByUI = byUI.sorted(0)
+	report.ByModelType = byModelType.sorted(0)
+	report.ByBaseModel = byBaseModel.sorted(0)
+	report.ByAuthor = byAuthor.sorted(maxAuthorUsageBuckets)
+	for _, usage := range bySubDir {
+		report.BySubDir = append(report.BySubDir, *usage)
+	}
+	sort.Slice(report.BySubDir, func(i, j int) bool {
+		if report.BySubDir[i].Size == report.BySubDir[j].Size {
+			return report.BySubDir[i].Path < report.BySubDir[j].Path
+		}
+		return report.BySubDir[i].Size > report.BySubDir[j].Size
+	})
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Size > rows[j].Size
+	})
+	for _, row := range rows[:lo.Min([]int{largestLimit, len(rows)})] {
+		report.LargestFiles = append(report.LargestFiles, LargeFileUsage{
+			FileId:      row.Id,
+			FilePath:    row.FullPath,
+			FileName:    row.FileName,
+			Size:        row.Size,
+			ModelName:   row.ModelName,
+			VersionName: row.VersionName,
+		})
+	}
+	report.Duplicates, report.DuplicatesScannedAt = computeDuplicateUsage(rows)
+	return report, nil
+}
@@ -65,7 +65,11 @@ func renameModelFile(ctx context.Context, fileId, newName string) error {
 		file.CivitaiInfoPath = &newCivitaiInfoPath
 	}
 	result = dbConn.Save(&file)
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	logReindexError(ctx, reindexFileCaches(dbConn, file.Id))
+	return nil
 }
 
 func recordCustomBaseModel(ctx context.Context, fileId, baseModel string) error {
@@ -76,6 +80,26 @@ func recordCustomBaseModel(ctx context.Context, fileId, baseModel string) error
 		return fmt.Errorf("未找到指定的文件记录，%w", result.Error)
 	}
 	file.BaseModel = &baseModel
+	// 用户手动记录的基础模型不再是推断结果。
+	file.BaseModelConfidence = nil
+	result = dbConn.Save(&file)
+	if result.Error != nil {
+		return result.Error
+	}
+	logReindexError(ctx, reindexFileCaches(dbConn, file.Id))
+	logWebUIUserMetaError(ctx, &file, exportWebUIUserMeta(ctx, &file))
+	return nil
+}
+
+func recordCustomModelType(ctx context.Context, fileId, modelType string) error {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var file entities.FileCache
+	result := dbConn.Where("id = ?", fileId).First(&file)
+	if result.Error != nil {
+		return fmt.Errorf("未找到指定的文件记录，%w", result.Error)
+	}
+	file.ModelType = &modelType
+	file.ModelTypeConfidence = nil
 	result = dbConn.Save(&file)
 	return result.Error
 }
@@ -89,7 +113,12 @@ func recordModelMemo(ctx context.Context, fileId, memo string) error {
 	}
 	file.Memo = &memo
 	result = dbConn.Save(&file)
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	logReindexError(ctx, reindexFileCaches(dbConn, file.Id))
+	logWebUIUserMetaError(ctx, &file, exportWebUIUserMeta(ctx, &file))
+	return nil
 }
 
 func recordModelActivatePrompts(ctx context.Context, fileId, prompts string) error {
@@ -104,7 +133,12 @@ func recordModelActivatePrompts(ctx context.Context, fileId, prompts string) err
 	})
 	file.AdditionalPrompts = lo.Uniq(append(file.AdditionalPrompts, newPrompts...))
 	result = dbConn.Save(&file)
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	logReindexError(ctx, reindexFileCaches(dbConn, file.Id))
+	logWebUIUserMetaError(ctx, &file, exportWebUIUserMeta(ctx, &file))
+	return nil
 }
 
 func deleteModelPrompts(ctx context.Context, fileId string, prompts []string) error {
@@ -118,7 +152,12 @@ func deleteModelPrompts(ctx context.Context, fileId string, prompts []string) er
 		return lo.Contains(prompts, prompt)
 	}))
 	result = dbConn.Save(&file)
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	logReindexError(ctx, reindexFileCaches(dbConn, file.Id))
+	logWebUIUserMetaError(ctx, &file, exportWebUIUserMeta(ctx, &file))
+	return nil
 }
 
 func copyModelThumbnail(modelFileFullPath, originImageFilePath string) (string, error) {
@@ -249,7 +288,11 @@ func deleteModel(ctx context.Context, filePath string) error {
 		return fmt.Errorf("删除模型文件失败，%w", err)
 	}
 	result = dbConn.Unscoped().Where("full_path = ?", filePath).Delete(&file)
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+	logReindexError(ctx, removeFromSearchIndex(dbConn, file.Id))
+	return nil
 }
 
 func deleteModelVersionLocalFiles(ctx context.Context, versionId int) error {
@@ -289,6 +332,23 @@ func deleteModelVersionLocalFiles(ctx context.Context, versionId int) error {
 			}
 		}
 		dbConn.Delete(&localFile)
+		logReindexError(ctx, removeFromSearchIndex(dbConn, localFile.Id))
+	}
+	return nil
+}
+
+// 删除文件记录以及对应的元数据和检索索引。
+func deleteFileCaches(dbConn *gorm.DB, cacheIds ...string) error {
+	result := dbConn.Unscoped().Where("id IN ?", cacheIds).Delete(&entities.FileCache{})
+	if result.Error != nil {
+		return fmt.Errorf("删除缓存文件信息失败，%w", result.Error)
+	}
+	result = dbConn.Unscoped().Where("file_id IN ?", cacheIds).Delete(&entities.FileMetadata{})
+	if result.Error != nil {
+		return fmt.Errorf("删除缓存文件元数据失败，%w", result.Error)
+	}
+	if err := removeFromSearchIndex(dbConn, cacheIds...); err != nil {
+		return fmt.Errorf("删除缓存文件检索索引失败，%w", err)
 	}
 	return nil
 }
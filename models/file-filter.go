@@ -0,0 +1,231 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"gorm.io/gorm"
+)
+
+// 文件未关联Civitai模型，或者无法确定NSFW等级时使用的等级。
+const NSFWLevelUnknown = -1
+
+// 按照多个维度筛选本地模型文件的条件，同一维度中的多个取值之间为“或”的关系，不同维度之间为“与”的关系。
+// 标签是例外，文件关联的模型需要包含全部指定的标签。
+type ModelFileFilter struct {
+	Software         string     `json:"software"` // 未同时指定软件和模型类型时，筛选全部已缓存的模型文件。
+	Model            string     `json:"model"`
+	SubDir           string     `json:"subdir"`
+	BaseModels       []string   `json:"baseModels"`
+	ModelTypes       []string   `json:"modelTypes"` // 使用Civitai的模型类型名称。
+	NSFWLevels       []int      `json:"nsfwLevels"` // 取值参见entities中的NSFW等级，未关联模型的文件为-1。
+	PersonOfInterest *bool      `json:"poi"`
+	Tags             []string   `json:"tags"`
+	Authors          []string   `json:"authors"`
+	HasCivitaiInfo   *bool      `json:"hasCivitaiInfo"`
+	CivitaiDeleted   *bool      `json:"civitaiDeleted"`
+	CommercialUse    *bool      `json:"commercialUse"` // 是否允许商业用途，许可权限未知的文件不会被筛选出来。
+	MinSize          *uint64    `json:"minSize"`       // 字节数量，包含边界。
+	MaxSize          *uint64    `json:"maxSize"`
+	AddedAfter       *time.Time `json:"addedAfter"`
+	AddedBefore      *time.Time `json:"addedBefore"`
+	SortBy           string     `json:"sortBy"` // 与ModelFileQuery相同。
+	Descending       bool       `json:"descending"`
+	Page             int        `json:"page"`
+	PageSize         int        `json:"pageSize"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type ModelFilterResult struct {
+	Results *ModelFilePage `json:"results"`
+	// 以维度名称为键的各个取值的文件数量。统计某一维度时不应用该维度本身的筛选条件，以便界面展示其他可选的取值。
+	Facets map[string][]FacetCount `json:"facets"`
+}
+
+// 标签维度可能的取值非常多，只返回文件数量最多的部分。
+const maxTagFacets = 50
+
+// 筛选维度的名称，同时作为统计结果中的键。
+const (
+	facetBaseModel      = "baseModel"
+	facetModelType      = "modelType"
+	facetNSFWLevel      = "nsfwLevel"
+	facetPOI            = "poi"
+	facetTag            = "tag"
+	facetAuthor         = "author"
+	facetHasCivitaiInfo = "hasCivitaiInfo"
+	facetCivitaiDeleted = "civitaiDeleted"
+	facetCommercialUse  = "commercialUse"
+)
+
+// 各个筛选维度使用的SQL表达式，关联的模型信息来自`RelatedModel`和`RelatedModel.Model`两个关联查询。
+// 模型的NSFW等级取模型版本图片中的最高等级，没有图片时按照模型的NSFW标记区分为无或者成人内容。
+var modelFilterExpressions = map[string]string{
+	facetBaseModel: "COALESCE(`RelatedModel`.`base_model`, file_caches.base_model)",
+	facetModelType: "COALESCE(`RelatedModel__Model`.`type`, file_caches.model_type)",
+	facetNSFWLevel: fmt.Sprintf("CASE WHEN `RelatedModel__Model`.`id` IS NULL THEN %d ELSE COALESCE("+
+		"(SELECT MAX(images.nsfw) FROM images WHERE images.version_id = `RelatedModel`.`id` AND images.deleted_at IS NULL), "+
+		"CASE WHEN `RelatedModel__Model`.`nsfw` THEN %d ELSE %d END) END",
+		NSFWLevelUnknown, entities.NSFWLevelMature, entities.NSFWLeveNone),
+	facetPOI:            "CASE WHEN COALESCE(`RelatedModel__Model`.`person_of_interest`, 0) THEN 'true' ELSE 'false' END",
+	facetAuthor:         "json_extract(`RelatedModel__Model`.`author`, '$.username')",
+	facetHasCivitaiInfo: "CASE WHEN `RelatedModel`.`id` IS NOT NULL THEN 'true' ELSE 'false' END",
+	facetCivitaiDeleted: "CASE WHEN COALESCE(`RelatedModel__Model`.`civitail_deleted`, 0) THEN 'true' ELSE 'false' END",
+	facetCommercialUse: fmt.Sprintf("CASE WHEN `RelatedModel__Model`.`allow_commercial_use` IS NULL THEN NULL "+
+		"WHEN EXISTS (SELECT 1 FROM json_each(`RelatedModel__Model`.`allow_commercial_use`) WHERE json_each.value <> '%s') THEN 'true' ELSE 'false' END",
+		commercialUseNone),
+}
+
+// 统计维度数量时不需要加载关联的模型信息，使用与关联查询相同别名的普通连接，避免查询中混入关联记录的字段。
+const (
+	relatedVersionJoin = "LEFT JOIN model_versions `RelatedModel` ON file_caches.related_model_version_id = `RelatedModel`.`id` AND `RelatedModel`.`deleted_at` IS NULL"
+	relatedModelJoin   = "LEFT JOIN models `RelatedModel__Model` ON `RelatedModel`.`model_id` = `RelatedModel__Model`.`id` AND `RelatedModel__Model`.`deleted_at` IS NULL"
+)
+
+func boolFacetValue(value bool) string {
+	return lo.Ternary(value, "true", "false")
+}
+
+// 在已经连接了模型信息的查询上应用筛选条件，skip指定的维度不应用筛选条件，用于统计该维度的取值数量。
+func filteredModelFiles(dbConn, statement *gorm.DB, filter ModelFileFilter, skip string) *gorm.DB {
+	if len(filter.Software) > 0 && len(filter.Model) > 0 {
+		dirs := resolveModelQueryDirs(filter.Software, filter.Model, filter.SubDir)
+		if len(dirs) == 0 {
+			return statement.Where("1 = 0")
+		}
+		statement = statement.Where(modelDirCondition(dbConn, dirs, true))
+	}
+	if skip != facetBaseModel && len(filter.BaseModels) > 0 {
+		statement = statement.Where(modelFilterExpressions[facetBaseModel]+" IN ?", filter.BaseModels)
+	}
+	if skip != facetModelType && len(filter.ModelTypes) > 0 {
+		statement = statement.Where(modelFilterExpressions[facetModelType]+" IN ?", filter.ModelTypes)
+	}
+	if skip != facetNSFWLevel && len(filter.NSFWLevels) > 0 {
+		statement = statement.Where(modelFilterExpressions[facetNSFWLevel]+" IN ?", filter.NSFWLevels)
+	}
+	if skip != facetPOI && filter.PersonOfInterest != nil {
+		statement = statement.Where(modelFilterExpressions[facetPOI]+" = ?", boolFacetValue(*filter.PersonOfInterest))
+	}
+	if skip != facetTag && len(filter.Tags) > 0 {
+		tags := lo.Uniq(filter.Tags)
+		statement = statement.Where("(SELECT count(DISTINCT model_tags.tag) FROM model_tags WHERE model_tags.model_id = `RelatedModel`.`model_id` AND model_tags.tag IN ?) = ?", tags, len(tags))
+	}
+	if skip != facetAuthor && len(filter.Authors) > 0 {
+		statement = statement.Where(modelFilterExpressions[facetAuthor]+" IN ?", filter.Authors)
+	}
+	if skip != facetHasCivitaiInfo && filter.HasCivitaiInfo != nil {
+		statement = statement.Where(modelFilterExpressions[facetHasCivitaiInfo]+" = ?", boolFacetValue(*filter.HasCivitaiInfo))
+	}
+	if skip != facetCivitaiDeleted && filter.CivitaiDeleted != nil {
+		statement = statement.Where(modelFilterExpressions[facetCivitaiDeleted]+" = ?", boolFacetValue(*filter.CivitaiDeleted))
+	}
+	if skip != facetCommercialUse && filter.CommercialUse != nil {
+		statement = statement.Where(modelFilterExpressions[facetCommercialUse]+" = ?", boolFacetValue(*filter.CommercialUse))
+	}
+	if filter.MinSize != nil {
+		statement = statement.Where("file_caches.size >= ?", *filter.MinSize)
+	}
+	if filter.MaxSize != nil {
+		statement = statement.Where("file_caches.size <= ?", *filter.MaxSize)
+	}
+	if filter.AddedAfter != nil {
+		statement = statement.Where("file_caches.created_at >= ?", *filter.AddedAfter)
+	}
+	if filter.AddedBefore != nil {
+		statement = statement.Where("file_caches.created_at <= ?", *filter.AddedBefore)
+	}
+	return statement
+}
+
+// 统计一个维度中各个取值对应的文件数量，取值为空的文件不参与统计。
+func countModelFacet(dbConn *gorm.DB, filter ModelFileFilter, facet string) ([]FacetCount, error) {
+	counts := make([]FacetCount, 0)
+	facetStatement := dbConn.Model(&entities.FileCache{}).Joins(relatedVersionJoin).Joins(relatedModelJoin)
+	var result *gorm.DB
+	if facet == facetTag {
+		result = filteredModelFiles(dbConn, facetStatement, filter, facet).
+			Joins("JOIN model_tags ON model_tags.model_id = `RelatedModel`.`model_id`").
+			Select("model_tags.tag AS value, count(DISTINCT file_caches.id) AS count").
+			Group("model_tags.tag").
+			Order("count DESC, value ASC").
+			Limit(maxTagFacets).
+			Scan(&counts)
+	} else {
+		expression := modelFilterExpressions[facet]
+		result = filteredModelFiles(dbConn, facetStatement, filter, facet).
+			Select(fmt.Sprintf("CAST(%s AS TEXT) AS value, count(*) AS count", expression)).
+			Where(expression + " IS NOT NULL").
+			Group("value").
+			Order("count DESC, value ASC").
+			Scan(&counts)
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("统计筛选维度 [%s] 失败，%w", facet, result.Error)
+	}
+	return counts, nil
+}
+
+// 按照多个维度筛选本地模型文件，同时返回各个维度中可选取值的文件数量。筛选只使用数据库中已经缓存的文件记录。
+func filterModelFiles(ctx context.Context, filter ModelFileFilter) (*ModelFilterResult, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = defaultModelFilePageSize
+	}
+	filter.Tags = lo.Filter(lo.Map(filter.Tags, func(tag string, _ int) string {
+		return strings.TrimSpace(tag)
+	}), func(tag string, _ int) bool {
+		return len(tag) > 0
+	})
+	page := &ModelFilePage{
+		Items:    make([]SimpleModelDescript, 0),
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+	}
+	statement := dbConn.Model(&entities.FileCache{}).Joins("RelatedModel").Joins("RelatedModel.Model")
+	statement = filteredModelFiles(dbConn, statement, filter, "").Session(&gorm.Session{})
+	if result := statement.Count(&page.Total); result.Error != nil {
+		return nil, fmt.Errorf("统计模型文件数量失败，%w", result.Error)
+	}
+	sortExpression, ok := modelFileSortExpressions[filter.SortBy]
+	if !ok {
+		sortExpression = modelFileSortExpressions["name"]
+	}
+	direction := lo.Ternary(filter.Descending, "DESC", "ASC")
+	var caches []entities.FileCache
+	result := statement.
+		Order(fmt.Sprintf("%s %s, file_caches.file_name COLLATE NOCASE ASC", sortExpression, direction)).
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&caches)
+	if result.Error != nil {
+		return nil, fmt.Errorf("筛选模型文件失败，%w", result.Error)
+	}
+	for _, cache := range caches {
+		page.Items = append(page.Items, describeFileCache(cache))
+	}
+	filterResult := &ModelFilterResult{
+		Results: page,
+		Facets:  make(map[string][]FacetCount),
+	}
+	for _, facet := range []string{facetBaseModel, facetModelType, facetNSFWLevel, facetPOI, facetTag, facetAuthor, facetHasCivitaiInfo, facetCivitaiDeleted, facetCommercialUse} {
+		counts, err := countModelFacet(dbConn, filter, facet)
+		if err != nil {
+			return nil, err
+		}
+		filterResult.Facets[facet] = counts
+	}
+	return filterResult, nil
+}
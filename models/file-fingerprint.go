@@ -0,0 +1,86 @@
+package models
+
+import (
+	"sync/atomic"
+
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/vixalie/sd-content-manager/utils"
+	"gorm.io/gorm"
+)
+
+// 一次扫描过程中各类文件的数量统计，会在多个扫描协程中同时更新。
+type ScanStatistics struct {
+	Skipped int64 `json:"skipped"` // 文件指纹未变化，没有重新计算Hash的文件数量。
+	Changed int64 `json:"changed"` // 已经记录过但文件指纹发生变化，重新计算了Hash的文件数量。
+	Created int64 `json:"created"` // 首次记录的文件数量。
+	Moved   int64 `json:"moved"`   // 被移动或者重命名，在原记录上更新了路径的文件数量。
+	Failed  int64 `json:"failed"`  // 扫描失败的文件数量。
+}
+
+func (s *ScanStatistics) countSkipped() {
+	atomic.AddInt64(&s.Skipped, 1)
+}
+
+func (s *ScanStatistics) countChanged() {
+	atomic.AddInt64(&s.Changed, 1)
+}
+
+func (s *ScanStatistics) countCreated() {
+	atomic.AddInt64(&s.Created, 1)
+}
+
+func (s *ScanStatistics) countMoved() {
+	atomic.AddInt64(&s.Moved, 1)
+}
+
+func (s *ScanStatistics) countFailed() {
+	atomic.AddInt64(&s.Failed, 1)
+}
+
+// 获取当前统计结果的一份拷贝，用于向前端发送。
+func (s *ScanStatistics) Snapshot() ScanStatistics {
+	return ScanStatistics{
+		Skipped: atomic.LoadInt64(&s.Skipped),
+		Changed: atomic.LoadInt64(&s.Changed),
+		Created: atomic.LoadInt64(&s.Created),
+		Moved:   atomic.LoadInt64(&s.Moved),
+		Failed:  atomic.LoadInt64(&s.Failed),
+	}
+}
+
+// 旧版本中记录的文件缓存不包含文件指纹，此时修改时间字段为零值。
+func isFingerprintRecorded(cache *entities.FileCache) bool {
+	return cache.FileModTime != 0
+}
+
+func cachedFingerprint(cache *entities.FileCache) utils.FileFingerprint {
+	return utils.FileFingerprint{
+		Size:    int64(cache.Size),
+		ModTime: cache.FileModTime,
+		Inode:   cache.FileInode,
+		Device:  cache.FileDevice,
+	}
+}
+
+// 判断文件缓存中记录的文件指纹与当前文件的指纹是否一致。
+func isFingerprintMatched(cache *entities.FileCache, fingerprint *utils.FileFingerprint) bool {
+	return cachedFingerprint(cache).Equal(*fingerprint)
+}
+
+func applyFingerprint(cache *entities.FileCache, fingerprint *utils.FileFingerprint) {
+	cache.Size = uint64(fingerprint.Size)
+	cache.FileModTime = fingerprint.ModTime
+	cache.FileInode = fingerprint.Inode
+	cache.FileDevice = fingerprint.Device
+}
+
+// 为旧版本中记录的文件缓存补充文件指纹。这些文件在记录时已经计算过Hash，所以这里直接信任已有的记录，不再重新计算Hash。
+func backfillFingerprint(dbConn *gorm.DB, cacheId string, fingerprint *utils.FileFingerprint) error {
+	result := dbConn.Model(&entities.FileCache{}).Where("id = ?", cacheId).Updates(map[string]any{
+		"size":          fingerprint.Size,
+		"file_mod_time": fingerprint.ModTime,
+		"file_inode":    fingerprint.Inode,
+		"file_device":   fingerprint.Device,
+	})
+	return result.Error
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/config"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/vixalie/sd-content-manager/utils"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// 计算模型文件的Hash。如果SD WebUI已经为未发生变化的文件计算过SHA256，那么将直接使用其结果，只补充计算AutoV1，
+// 避免首次扫描已有的SD WebUI时重新读取全部模型文件。这种情况下CRC32和BLAKE3将留空，可以由用户通过computeMissingHashes补充。
+func computeFileHashes(ctx context.Context, filePath string, fingerprint *utils.FileFingerprint) (*utils.FileHashes, error) {
+	sha256Hex, found, err := config.LookupWebUIHashCache(filePath, fingerprint.ModTime)
+	if err != nil {
+		runtime.LogWarningf(ctx, "读取SD WebUI缓存的文件Hash失败，%s", err)
+	}
+	if found {
+		autoV1, err := utils.AutoV1File(filePath)
+		if err == nil {
+			runtime.LogDebugf(ctx, "使用SD WebUI缓存的文件Hash：%s", filePath)
+			return &utils.FileHashes{
+				SHA256: sha256Hex,
+				AutoV1: autoV1,
+				AutoV2: utils.AutoV2FromSHA256(sha256Hex),
+			}, nil
+		}
+	}
+	return utils.HashFileWithOptions(filePath, fileIOScheduler.device(fingerprint.Device).hashOptions())
+}
+
+func applyFileHashes(file *entities.FileCache, hashes *utils.FileHashes) {
+	file.FileIdentityHash = hashes.SHA256
+	file.CRC32 = hashes.CRC32
+	file.AutoV1 = hashes.AutoV1
+	file.AutoV2 = hashes.AutoV2
+	file.Blake3 = hashes.BLAKE3
+}
+
+// 判断模型文件的容器格式，无法读取文件时记录为未知格式。
+func detectFileFormat(ctx context.Context, filePath string) string {
+	format, err := utils.DetectModelFormat(filePath)
+	if err != nil {
+		runtime.LogErrorf(ctx, "判断文件 [%s] 格式失败，%s", filePath, err)
+	}
+	return format
+}
+
+// 为较早记录的文件补充AutoV1、AutoV2和文件格式。AutoV2可以直接由SHA256得到，AutoV1和文件格式也只需要读取文件的一小部分，
+// 所以不需要重新读取整个文件。CRC32和BLAKE3需要读取整个文件，可以由用户通过computeMissingHashes补充。
+func backfillLegacyCache(dbConn *gorm.DB, file *entities.FileCache) error {
+	if len(file.AutoV1) > 0 && len(file.AutoV2) > 0 && len(file.Format) > 0 {
+		return nil
+	}
+	autoV1, err := utils.AutoV1File(file.FullPath)
+	if err != nil {
+		return err
+	}
+	format, err := utils.DetectModelFormat(file.FullPath)
+	if err != nil {
+		return err
+	}
+	file.AutoV1 = autoV1
+	file.AutoV2 = utils.AutoV2FromSHA256(file.FileIdentityHash)
+	file.Format = format
+	result := dbConn.Model(&entities.FileCache{}).Where("id = ?", file.Id).Updates(map[string]any{
+		"auto_v1": file.AutoV1,
+		"auto_v2": file.AutoV2,
+		"format":  file.Format,
+	})
+	return result.Error
+}
+
+// 为缺少CRC32或者BLAKE3的文件记录补充Hash。这些Hash需要读取整个文件，所以只在用户要求时作为扫描任务运行，
+// 可以暂停和取消，并且遵守文件所在设备的并发读取限制。文件在记录之后发生过变化的，留待下次扫描时重新处理。
+func computeMissingHashes(ctx context.Context) error {
+	job, err := registerScanJob(ctx, ScanJobHashBackfill)
+	if err != nil {
+		return err
+	}
+	err = runHashBackfill(job)
+	job.finish(err)
+	return err
+}
+
+func runHashBackfill(job *ScanJob) error {
+	ctx := job.ctx
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var files []entities.FileCache
+	result := dbConn.Where("crc32 IS NULL OR crc32 = '' OR blake3 IS NULL OR blake3 = ''").Find(&files)
+	if result.Error != nil {
+		return fmt.Errorf("查询缺少Hash的文件记录失败，%w", result.Error)
+	}
+	job.setTotal(int64(len(files)), lo.SumBy(files, func(file entities.FileCache) int64 {
+		return int64(file.Size)
+	}))
+	scanErr := scheduleByDevice(ctx, files, func(file entities.FileCache) string {
+		return file.FullPath
+	}, job.waitIfPaused, func(file entities.FileCache) {
+		defer job.advance(scanTarget{Path: file.FullPath, Size: int64(file.Size)})
+		fingerprint, err := utils.StatFileFingerprint(file.FullPath)
+		if err != nil || !isFingerprintMatched(&file, fingerprint) {
+			return
+		}
+		hashes, err := utils.HashFileWithOptions(file.FullPath, fileIOScheduler.device(fingerprint.Device).hashOptions())
+		if err != nil {
+			runtime.LogErrorf(ctx, "补充文件 [%s] 的Hash失败，%s", file.FullPath, err)
+			return
+		}
+		if hashes.SHA256 != file.FileIdentityHash {
+			return
+		}
+		result := dbConn.Model(&entities.FileCache{}).Where("id = ?", file.Id).Updates(map[string]any{
+			"crc32":  hashes.CRC32,
+			"blake3": hashes.BLAKE3,
+		})
+		if result.Error != nil {
+			runtime.LogErrorf(ctx, "保存文件 [%s] 补充的Hash失败，%s", file.FullPath, result.Error)
+		}
+	})
+	if scanErr != nil && ctx.Err() != nil {
+		return ErrScanJobCanceled
+	}
+	return scanErr
+}
+
+// 使用任意一种Hash值查找本地文件记录，Hash值不区分大小写。
+func findFileCacheByAnyHash(ctx context.Context, fileHash string) (*entities.FileCache, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	fileHash = strings.ToUpper(strings.TrimSpace(fileHash))
+	if len(fileHash) == 0 {
+		return nil, errors.New("未提供需要查找的Hash值")
+	}
+	var file entities.FileCache
+	result := dbConn.
+		Where("file_identity_hash = ? OR auto_v2 = ? OR auto_v1 = ? OR blake3 = ? OR crc32 = ?", fileHash, fileHash, fileHash, fileHash, fileHash).
+		Order("created_at").
+		First(&file)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("查找Hash对应的本地文件失败，%w", result.Error)
+	}
+	return &file, nil
+}
+
+// 使用任意一种Hash值查找对应的模型文件信息。首先通过本地文件记录转换为SHA256，然后再在Civitai提供的文件Hash中查找。
+func findModelFileByAnyHash(ctx context.Context, fileHash string) (*entities.ModelFile, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	fileHash = strings.ToUpper(strings.TrimSpace(fileHash))
+	localFile, err := findFileCacheByAnyHash(ctx, fileHash)
+	if err != nil {
+		return nil, err
+	}
+	if localFile != nil {
+		fileHash = localFile.FileIdentityHash
+	}
+	var file entities.ModelFile
+	result := dbConn.Joins("Version").Joins("Version.Model").
+		Where("identity_hash = ?", fileHash).
+		Or("upper(json_extract(model_files.hashes, '$.AutoV2')) = ?", fileHash).
+		Or("upper(json_extract(model_files.hashes, '$.AutoV1')) = ?", fileHash).
+		Or("upper(json_extract(model_files.hashes, '$.BLAKE3')) = ?", fileHash).
+		Or("upper(json_extract(model_files.hashes, '$.CRC32')) = ?", fileHash).
+		First(&file)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("查找Hash对应的模型文件失败，%w", result.Error)
+	}
+	return &file, nil
+}
@@ -0,0 +1,203 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vixalie/sd-content-manager/config"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+const defaultModelFilePageSize = 50
+
+// 分页列举模型文件的查询条件。
+type ModelFileQuery struct {
+	Software   string `json:"software"`
+	Model      string `json:"model"`
+	SubDir     string `json:"subdir"`
+	Recursive  bool   `json:"recursive"` // 是否包含子目录中的模型文件。
+	Keyword    string `json:"keyword"`
+	SortBy     string `json:"sortBy"` // 可选name、size、added、baseModel、rating，默认使用name。
+	Descending bool   `json:"descending"`
+	Page       int    `json:"page"` // 页码从1开始。
+	PageSize   int    `json:"pageSize"`
+	Refresh    bool   `json:"refresh"` // 是否在查询之前扫描目录中尚未缓存或者发生变化的文件。
+}
+
+type ModelFilePage struct {
+	Items    []SimpleModelDescript `json:"items"`
+	Total    int64                 `json:"total"`
+	Page     int                   `json:"page"`
+	PageSize int                   `json:"pageSize"`
+}
+
+// 排序字段使用的SQL表达式，关联的模型信息来自`RelatedModel`和`RelatedModel.Model`两个关联查询。
+var modelFileSortExpressions = map[string]string{
+	"name":      "COALESCE(`RelatedModel__Model`.`name`, file_caches.file_name) COLLATE NOCASE",
+	"size":      "file_caches.size",
+	"added":     "file_caches.created_at",
+	"baseModel": "COALESCE(`RelatedModel`.`base_model`, file_caches.base_model) COLLATE NOCASE",
+	"rating":    "COALESCE(`RelatedModel`.`rating`, 0)",
+}
+
+// 获取查询条件中指定的模型目录，即模型类型目录下的子目录。
+func resolveModelQueryDirs(software, model, subdir string) []string {
+	var targetDirs []string
+	switch config.MatchSoftware(software) {
+	case config.ComfyUI:
+		targetDirs, _ = config.GetComfyModelPath(model)
+	case config.WebUI:
+		targetDirs, _ = config.GetWebUIModelPath(model)
+	}
+	dirs := make([]string, 0, len(targetDirs))
+	for _, dir := range targetDirs {
+		if len(dir) == 0 {
+			continue
+		}
+		dirs = append(dirs, filepath.Clean(filepath.Join(dir, subdir)))
+	}
+	return dirs
+}
+
+// 列举目录中的模型文件，可以选择是否包含子目录。
+func listModelFilesInDirs(model string, dirs []string, recursive bool) []string {
+	files := make([]string, 0)
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if !recursive && path != dir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if config.IsModelExtension(model, strings.ToLower(filepath.Ext(path))) {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+func escapeLikePattern(pattern string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(pattern)
+}
+
+// 生成限定文件所在目录的查询条件。不包含子目录时，要求文件路径在目录前缀之后不再包含路径分隔符。
+func modelDirCondition(dbConn *gorm.DB, dirs []string, recursive bool) *gorm.DB {
+	condition := dbConn
+	for i, dir := range dirs {
+		prefix := dir + string(os.PathSeparator)
+		var dirQuery *gorm.DB
+		if recursive {
+			dirQuery = dbConn.Where(`file_caches.full_path LIKE ? ESCAPE '\'`, escapeLikePattern(prefix)+"%")
+		} else {
+			dirQuery = dbConn.Where(`file_caches.full_path LIKE ? ESCAPE '\' AND instr(substr(file_caches.full_path, ?), ?) = 0`,
+				escapeLikePattern(prefix)+"%", utf8.RuneCountInString(prefix)+1, string(os.PathSeparator))
+		}
+		if i == 0 {
+			condition = condition.Where(dirQuery)
+		} else {
+			condition = condition.Or(dirQuery)
+		}
+	}
+	return condition
+}
+
+// 在数据库中分页查询模型文件。只有在要求刷新时才会访问文件系统，扫描目录中尚未缓存或者已经发生变化的文件。
+func queryModelFiles(ctx context.Context, query ModelFileQuery) (*ModelFilePage, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = defaultModelFilePageSize
+	}
+	page := &ModelFilePage{
+		Items:    make([]SimpleModelDescript, 0),
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}
+	dirs := resolveModelQueryDirs(query.Software, query.Model, query.SubDir)
+	if len(dirs) == 0 {
+		return page, nil
+	}
+	if query.Refresh {
+		if err := cacheModelFiles(ctx, listModelFilesInDirs(query.Model, dirs, query.Recursive)); err != nil {
+			return nil, err
+		}
+	}
+	statement := dbConn.Model(&entities.FileCache{}).
+		Joins("RelatedModel").
+		Joins("RelatedModel.Model").
+		Where(modelDirCondition(dbConn, dirs, query.Recursive)).
+		Session(&gorm.Session{})
+	if keyword := strings.TrimSpace(query.Keyword); len(keyword) > 0 {
+		pattern := "%" + escapeLikePattern(keyword) + "%"
+		statement = statement.Where("(file_caches.file_name LIKE ? ESCAPE '\\' OR `RelatedModel__Model`.`name` LIKE ? ESCAPE '\\')", pattern, pattern).Session(&gorm.Session{})
+	}
+	if result := statement.Count(&page.Total); result.Error != nil {
+		return nil, fmt.Errorf("统计模型文件数量失败，%w", result.Error)
+	}
+	sortExpression, ok := modelFileSortExpressions[query.SortBy]
+	if !ok {
+		sortExpression = modelFileSortExpressions["name"]
+	}
+	direction := "ASC"
+	if query.Descending {
+		direction = "DESC"
+	}
+	var caches []entities.FileCache
+	result := statement.
+		Order(fmt.Sprintf("%s %s, file_caches.file_name COLLATE NOCASE ASC", sortExpression, direction)).
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Find(&caches)
+	if result.Error != nil {
+		return nil, fmt.Errorf("查询模型文件失败，%w", result.Error)
+	}
+	for _, cache := range caches {
+		page.Items = append(page.Items, describeFileCache(cache))
+	}
+	return page, nil
+}
+
+// 为在记录Civitai评分之前保存的模型版本，从保存的Civitai原始响应中补充评分和下载数量。
+func backfillModelVersionStats(ctx context.Context) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var versions []entities.ModelVersion
+	result := dbConn.Select("id", "civitai_original_response").
+		Where("rating_count = 0 AND download_count = 0 AND civitai_original_response IS NOT NULL").
+		Find(&versions)
+	if result.Error != nil {
+		runtime.LogErrorf(ctx, "查询需要补充评分的模型版本失败，%s", result.Error)
+		return
+	}
+	for _, version := range versions {
+		var versionInfo ModelVersion
+		if err := json.Unmarshal(version.CivitaiOriginalResponse, &versionInfo); err != nil {
+			continue
+		}
+		if versionInfo.Stats.RatingCount == 0 && versionInfo.Stats.DownloadCount == 0 {
+			continue
+		}
+		dbConn.Model(&entities.ModelVersion{}).Where("id = ?", version.Id).Updates(map[string]any{
+			"rating":         versionInfo.Stats.Rating.InexactFloat64(),
+			"rating_count":   versionInfo.Stats.RatingCount,
+			"download_count": versionInfo.Stats.DownloadCount,
+		})
+	}
+}
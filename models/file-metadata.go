@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/vixalie/sd-content-manager/utils"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func metadataValue(metadata map[string]string, key string) *string {
+	value, ok := metadata[key]
+	if !ok || len(value) == 0 || value == "None" {
+		return nil
+	}
+	return &value
+}
+
+// 从模型文件中提取内嵌元数据，只有Safetensors文件才会被读取。文件中不包含元数据时返回nil。
+func extractFileMetadata(filePath string) (*entities.FileMetadata, error) {
+	if format, _ := utils.DetectModelFormat(filePath); format != utils.FormatSafetensors {
+		return nil, nil
+	}
+	header, err := utils.ReadSafetensorsHeader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.Metadata) == 0 {
+		return nil, nil
+	}
+	metadata := &entities.FileMetadata{
+		BaseModelVersion: metadataValue(header.Metadata, "ss_base_model_version"),
+		NetworkModule:    metadataValue(header.Metadata, "ss_network_module"),
+		NetworkDim:       metadataValue(header.Metadata, "ss_network_dim"),
+		NetworkAlpha:     metadataValue(header.Metadata, "ss_network_alpha"),
+		Architecture:     metadataValue(header.Metadata, "modelspec.architecture"),
+		Title:            metadataValue(header.Metadata, "modelspec.title"),
+		Raw:              header.Metadata,
+	}
+	// ss_tag_frequency是以字符串形式保存的JSON，其中记录了每个训练数据集中各个标签出现的次数。
+	if tagFrequency := metadataValue(header.Metadata, "ss_tag_frequency"); tagFrequency != nil {
+		var frequency map[string]map[string]int
+		if err := json.Unmarshal([]byte(*tagFrequency), &frequency); err == nil {
+			metadata.TagFrequency = frequency
+		}
+	}
+	return metadata, nil
+}
+
+// 提取并保存模型文件的内嵌元数据，文件已经不再包含元数据时将删除原有的记录。
+func recordFileMetadata(ctx context.Context, fileId, filePath string) error {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	metadata, err := extractFileMetadata(filePath)
+	if err != nil {
+		return fmt.Errorf("未能读取模型文件元数据，%w", err)
+	}
+	if metadata == nil {
+		return dbConn.Unscoped().Where("file_id = ?", fileId).Delete(&entities.FileMetadata{}).Error
+	}
+	metadata.FileId = fileId
+	result := dbConn.Clauses(clause.OnConflict{UpdateAll: true}).Create(metadata)
+	if result.Error != nil {
+		return fmt.Errorf("未能保存模型文件元数据，%w", result.Error)
+	}
+	return nil
+}
+
+// 获取指定文件的内嵌元数据。在元数据功能出现之前记录的文件会在第一次获取时读取文件并保存元数据。
+// 文件不包含元数据时返回nil。
+func fetchFileMetadata(ctx context.Context, fileId string) (*entities.FileMetadata, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var metadata entities.FileMetadata
+	result := dbConn.Where("file_id = ?", fileId).First(&metadata)
+	if result.Error == nil {
+		return &metadata, nil
+	}
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询模型文件元数据失败，%w", result.Error)
+	}
+	var fileCache entities.FileCache
+	if result := dbConn.Where("id = ?", fileId).First(&fileCache); result.Error != nil {
+		return nil, fmt.Errorf("未找到指定的模型文件，%w", result.Error)
+	}
+	if err := recordFileMetadata(ctx, fileCache.Id, fileCache.FullPath); err != nil {
+		runtime.LogErrorf(ctx, "提取文件 [%s] 元数据失败，%s", fileCache.FullPath, err)
+		return nil, err
+	}
+	result = dbConn.Where("file_id = ?", fileId).First(&metadata)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("查询模型文件元数据失败，%w", result.Error)
+	}
+	return &metadata, nil
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/vixalie/sd-content-manager/utils"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+type FileMovedEventPayload struct {
+	Id   string `json:"id"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// 从候选记录中挑选出原路径上的文件已经不存在的记录，只有这样的记录才可以被认为是发生了移动。
+func pickVanishedFileCache(candidates []entities.FileCache, newPath string) *entities.FileCache {
+	for _, candidate := range candidates {
+		if candidate.FullPath == newPath {
+			continue
+		}
+		if _, err := os.Stat(candidate.FullPath); errors.Is(err, os.ErrNotExist) {
+			return &candidate
+		}
+	}
+	return nil
+}
+
+// 利用文件指纹查找被移动的文件记录。在同一文件系统中移动或者重命名文件不会改变Inode和修改时间，所以不需要计算Hash。
+// 文件被删除之后Inode会被重新使用，同一结构的模型文件大小也常常相同，所以修改时间也必须一致，否则需要通过Hash确认。
+func findMovedFileByFingerprint(ctx context.Context, filePath string, fingerprint *utils.FileFingerprint) (*entities.FileCache, error) {
+	if fingerprint.Inode == 0 {
+		return nil, nil
+	}
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var candidates []entities.FileCache
+	result := dbConn.Where("file_inode = ? AND file_device = ? AND size = ? AND file_mod_time = ?", fingerprint.Inode, fingerprint.Device, fingerprint.Size, fingerprint.ModTime).Find(&candidates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("查询文件指纹相同的文件记录失败，%w", result.Error)
+	}
+	return pickVanishedFileCache(candidates, filePath), nil
+}
+
+// 利用文件内容Hash查找被移动的文件记录，用于识别跨文件系统的移动。
+func findMovedFileByHash(ctx context.Context, filePath, fileHash string) (*entities.FileCache, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var candidates []entities.FileCache
+	result := dbConn.Where("file_identity_hash = ?", fileHash).Find(&candidates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("查询文件Hash相同的文件记录失败，%w", result.Error)
+	}
+	return pickVanishedFileCache(candidates, filePath), nil
+}
+
+// 将已有的文件记录更新到文件的新位置上，文件记录中用户记录的备注、提示词和基础模型等信息都将保留。
+// 文件的缩略图和Civitai Info文件将重新在新位置上收集。
+func relocateFileCache(ctx context.Context, cache *entities.FileCache, newPath string, fingerprint *utils.FileFingerprint) error {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	oldPath := cache.FullPath
+	thumbnailPath, descriptionPath, err := collectAccompanyFile(newPath)
+	if err != nil {
+		return fmt.Errorf("收集移动后模型文件的陪同文件失败，%w", err)
+	}
+	if thumbnailPath == nil {
+		cache.ThumbnailPHash = nil
+	} else if cache.ThumbnailPath == nil || filepath.Base(*cache.ThumbnailPath) != filepath.Base(*thumbnailPath) || cache.ThumbnailPHash == nil {
+		thumbnailHash, err := utils.PHashImage(*thumbnailPath)
+		if err != nil {
+			return fmt.Errorf("计算移动后模型文件缩略图Hash失败，%w", err)
+		}
+		cache.ThumbnailPHash = &thumbnailHash
+	}
+	cache.FullPath = newPath
+	cache.FileName = filepath.Base(newPath)
+	cache.ThumbnailPath = thumbnailPath
+	cache.CivitaiInfoPath = descriptionPath
+	applyFingerprint(cache, fingerprint)
+	result := dbConn.Save(cache)
+	if result.Error != nil {
+		return fmt.Errorf("更新移动后的文件记录失败，%w", result.Error)
+	}
+	logReindexError(ctx, reindexFileCaches(dbConn, cache.Id))
+	runtime.LogInfof(ctx, "文件 [%s] 已经移动至 [%s]", oldPath, newPath)
+	runtime.EventsEmit(ctx, "model-file-moved", FileMovedEventPayload{Id: cache.Id, From: oldPath, To: newPath})
+	return nil
+}
@@ -6,41 +6,38 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 
-	"archgrid.xyz/ag/toolsbox/hash/crc32"
-	"archgrid.xyz/ag/toolsbox/hash/sha256"
 	"archgrid.xyz/ag/toolsbox/serial_code/hail"
-	"archgrid.xyz/ag/toolsbox/serialize/hex"
 	"github.com/samber/lo"
 	"github.com/vixalie/sd-content-manager/config"
 	"github.com/vixalie/sd-content-manager/db"
 	"github.com/vixalie/sd-content-manager/entities"
 	"github.com/vixalie/sd-content-manager/utils"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
-	"golang.org/x/sync/semaphore"
 	"gorm.io/gorm"
 )
 
 type SimpleModelDescript struct {
-	Id             string   `json:"id"`
-	Name           string   `json:"name"`
-	VersionName    string   `json:"versionName"`
-	NSFW           bool     `json:"nsfw"`
-	FilePath       string   `json:"filePath"`
-	Type           *string  `json:"type"`
-	ThumbnailPath  *string  `json:"thumbnailPath"`
-	FileHash       string   `json:"fileHash"`
-	ActivatePrompt []string `json:"activatePrompt"`
-	Memo           *string  `json:"memo"`
-	BaseModel      *string  `json:"baseModel"`
-	Related        bool     `json:"related"`
-	RelatedModel   *int     `json:"relatedModel"`
-	RelatedVersion *int     `json:"relatedVersion"`
+	Id                  string   `json:"id"`
+	Name                string   `json:"name"`
+	VersionName         string   `json:"versionName"`
+	NSFW                bool     `json:"nsfw"`
+	FilePath            string   `json:"filePath"`
+	Type                *string  `json:"type"`
+	ThumbnailPath       *string  `json:"thumbnailPath"`
+	FileHash            string   `json:"fileHash"`
+	ActivatePrompt      []string `json:"activatePrompt"`
+	Memo                *string  `json:"memo"`
+	BaseModel           *string  `json:"baseModel"`
+	BaseModelConfidence *string  `json:"baseModelConfidence"` // 类型和基础模型由文件内容推断得出时的可信程度，来自Civitai或者用户手动记录的内容为空。
+	TypeConfidence      *string  `json:"typeConfidence"`
+	PickleVerdict       *string  `json:"pickleVerdict"` // 本地pickle安全检查的结论，用于在列表中提示危险的文件。
+	CommercialUse       *bool    `json:"commercialUse"` // 关联的模型是否允许商业用途，未关联模型或者许可权限未知时为空。
+	Related             bool     `json:"related"`
+	RelatedModel        *int     `json:"relatedModel"`
+	RelatedVersion      *int     `json:"relatedVersion"`
 }
 
-var modelExts = []string{".safetensors", ".pt", ".pth", ".pickle"}
-
 func scanModelFiles(ctx context.Context, software, model, subdir, keyword string) ([]SimpleModelDescript, error) {
 	var (
 		files         []string              = make([]string, 0)
@@ -67,38 +64,16 @@ func scanModelFiles(ctx context.Context, software, model, subdir, keyword string
 				continue
 			}
 			loweredExt := strings.ToLower(filepath.Ext(item.Name()))
-			if lo.Contains(modelExts, loweredExt) {
+			if config.IsModelExtension(model, loweredExt) {
 				files = append(files, filepath.Join(scanTarget, item.Name()))
 			}
 		}
 	}
-	// 检索全部数据库中未保存过的文件
-	uncachedFiles, err := searchUncachedFiles(ctx, files)
-	if err != nil {
-		return descriptions, fmt.Errorf("查询未缓存文件出错，%w", err)
-	}
-	// 如果存在数据库中未保存的文件，那么就需要对这些文件进行扫描处理
-	totalUncachedFiles := len(uncachedFiles)
-	if len(uncachedFiles) > 0 {
-		runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "start", "amount": totalUncachedFiles})
-		var (
-			semaphore = semaphore.NewWeighted(10)
-			group     sync.WaitGroup
-		)
-		// 扫描并解析其伴随文件
-		for _, uncachedFile := range uncachedFiles {
-			if err := semaphore.Acquire(ctx, 1); err != nil {
-				return descriptions, fmt.Errorf("扫描控制过程失败，无法继续处理未扫描模型文件，%w", err)
-			}
-			group.Add(1)
-			go scanModelFile(ctx, semaphore, &group, uncachedFile)
-		}
-		group.Wait()
-		// 未完成扫描的文件同样记录进入数据库，但不提供任何对应的模型信息。
-		runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "finish"})
+	if err := cacheModelFiles(ctx, files); err != nil {
+		return descriptions, err
 	}
 	// 重新从数据库检索全部列举到的文件。
-	descriptions, err = searchModelInfo(ctx, files)
+	descriptions, err := searchModelInfo(ctx, files)
 	if err != nil {
 		return descriptions, fmt.Errorf("查询模型信息出错，%w", err)
 	}
@@ -112,14 +87,68 @@ func scanModelFiles(ctx context.Context, software, model, subdir, keyword string
 	return descriptions, nil
 }
 
+// 检索全部数据库中未保存过的文件以及保存后发生过变化的文件，并对这些文件进行扫描处理。
+func cacheModelFiles(ctx context.Context, files []string) error {
+	var stats ScanStatistics
+	uncachedFiles, err := searchUncachedFiles(ctx, &stats, files)
+	if err != nil {
+		return fmt.Errorf("查询未缓存文件出错，%w", err)
+	}
+	// 如果存在数据库中未保存的文件，那么就需要对这些文件进行扫描处理
+	totalUncachedFiles := len(uncachedFiles)
+	if len(uncachedFiles) > 0 {
+		runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "start", "amount": totalUncachedFiles})
+		// 扫描并解析其伴随文件，文件按照所在的存储设备分组扫描。
+		err := scheduleByDevice(ctx, uncachedFiles, func(path string) string {
+			return path
+		}, nil, func(path string) {
+			scanModelFile(ctx, &stats, path)
+		})
+		if err != nil {
+			return fmt.Errorf("扫描控制过程失败，无法继续处理未扫描模型文件，%w", err)
+		}
+		// 未完成扫描的文件同样记录进入数据库，但不提供任何对应的模型信息。
+		runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "finish", "summary": stats.Snapshot(), "devices": fileIOScheduler.metrics()})
+	}
+	return nil
+}
+
 // 注意本函数会运行在独立的协程中，不要返回任何错误，每次也应该值处理一个文件或者一个模型。
-func scanModelFile(ctx context.Context, weighted *semaphore.Weighted, group *sync.WaitGroup, filePath string) {
-	defer runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "progress", "amount": 1})
-	defer weighted.Release(1)
-	defer group.Done()
+func scanModelFile(ctx context.Context, stats *ScanStatistics, filePath string) {
+	defer func() {
+		runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "progress", "amount": 1, "devices": fileIOScheduler.metrics()})
+	}()
 	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	fingerprint, err := utils.StatFileFingerprint(filePath)
+	if err != nil {
+		stats.countFailed()
+		runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "error", "message": "未能获取模型文件信息。", "error": err.Error()})
+		return
+	}
+	// 已经记录过的文件说明其文件指纹发生了变化，需要在原记录上更新。
+	var cachedFile *entities.FileCache
+	var existsCache entities.FileCache
+	if result := dbConn.Where("full_path = ?", filePath).First(&existsCache); result.Error == nil {
+		cachedFile = &existsCache
+	} else {
+		// 未记录过的路径首先尝试使用文件指纹识别被移动或者重命名的文件。
+		movedFile, err := findMovedFileByFingerprint(ctx, filePath, fingerprint)
+		if err != nil {
+			runtime.LogErrorf(ctx, "检查文件 [%s] 是否被移动失败，%s", filePath, err)
+		}
+		if movedFile != nil {
+			if err := relocateFileCache(ctx, movedFile, filePath, fingerprint); err != nil {
+				stats.countFailed()
+				runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "error", "message": "未能更新被移动的模型文件记录。", "error": err.Error()})
+				return
+			}
+			stats.countMoved()
+			return
+		}
+	}
 	thumbnailPath, descriptionPath, err := collectAccompanyFile(filePath)
 	if err != nil {
+		stats.countFailed()
 		runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "error", "message": "未找到模型对应的Civitai Info文件和缩略图文件。", "error": err.Error()})
 		return
 	}
@@ -127,21 +156,34 @@ func scanModelFile(ctx context.Context, weighted *semaphore.Weighted, group *syn
 	if thumbnailPath != nil {
 		hash, err := utils.PHashImage(*thumbnailPath)
 		if err != nil {
+			stats.countFailed()
 			runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "error", "message": "未能成功计算模型文件缩略图Hash校验值。", "error": err.Error()})
 			return
 		}
 		thumbnailHash = &hash
 	}
 	fileBaseName := filepath.Base(filePath)
-	fileHash, err := sha256.SumFile256Hex(filePath)
+	fileHashes, err := computeFileHashes(ctx, filePath, fingerprint)
 	if err != nil {
+		stats.countFailed()
 		runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "error", "message": "未能成功计算模型文件Hash校验值。", "error": err.Error()})
 		return
 	}
-	fileCrc32, err := crc32.SumFile(filePath)
-	if err != nil {
-		runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "error", "message": "未能成功计算模型文件CRC32校验值。", "error": err.Error()})
-		return
+	if cachedFile == nil {
+		// 根据文件Hash检查文件是否是从已经不存在的位置移动过来的
+		movedFile, err := findMovedFileByHash(ctx, filePath, fileHashes.SHA256)
+		if err != nil {
+			runtime.LogErrorf(ctx, "检查文件 [%s] 是否被移动失败，%s", filePath, err)
+		}
+		if movedFile != nil {
+			if err := relocateFileCache(ctx, movedFile, filePath, fingerprint); err != nil {
+				stats.countFailed()
+				runtime.EventsEmit(ctx, "scanUncachedFiles", map[string]any{"state": "error", "message": "未能更新被移动的模型文件记录。", "error": err.Error()})
+				return
+			}
+			stats.countMoved()
+			return
+		}
 	}
 	if descriptionPath != nil {
 		// 这里处理的是Civitai Info文件已经被发现的情形。
@@ -159,90 +201,127 @@ func scanModelFile(ctx context.Context, weighted *semaphore.Weighted, group *syn
 		// 这里继续保存从模型Version中可以提取的各种信息。
 	}
 TERMINATE_PARSE:
-	// 处理实际的文件信息，将文件保存到数据库的FileCache中。
-	fileInfo, _ := os.Stat(filePath)
+	// 处理实际的文件信息，将文件保存到数据库的FileCache中。已经记录过的文件将在原记录上更新，以保留用户记录的备注和提示词等内容。
 	hail := ctx.Value("hail").(*hail.HailAlgorithm)
 	fileCache := entities.FileCache{
-		Id:               hail.GeneratePrefixedString("F"),
-		FileIdentityHash: strings.ToUpper(fileHash),
-		FileName:         fileBaseName,
-		FullPath:         filePath,
-		ThumbnailPath:    thumbnailPath,
-		ThumbnailPHash:   thumbnailHash,
-		CivitaiInfoPath:  descriptionPath,
-		Size:             uint64(fileInfo.Size()),
-		CRC32:            strings.ToUpper(hex.ToHex(lo.Reverse(fileCrc32))), // 这里需要转换成小端序，还需要转换成大写形式。
+		Id: hail.GeneratePrefixedString("F"),
+	}
+	if cachedFile != nil {
+		fileCache = *cachedFile
+	}
+	fileCache.FileName = fileBaseName
+	fileCache.FullPath = filePath
+	fileCache.ThumbnailPath = thumbnailPath
+	fileCache.ThumbnailPHash = thumbnailHash
+	fileCache.CivitaiInfoPath = descriptionPath
+	applyFileHashes(&fileCache, fileHashes)
+	fileCache.Format = detectFileFormat(ctx, filePath)
+	fileCache.RelatedModelVersionId = nil
+	applyFingerprint(&fileCache, fingerprint)
+	_, exportUserMeta, err := importWebUIUserMeta(&fileCache)
+	if err != nil {
+		runtime.LogErrorf(ctx, "读取文件 [%s] 的SD WebUI用户信息失败，%s", filePath, err)
 	}
 	var cachedModelFile *entities.ModelFile
 	dbConn.Where(&entities.ModelFile{IdentityHash: fileCache.FileIdentityHash}).First(&cachedModelFile)
 	if cachedModelFile != nil {
 		fileCache.RelatedModelVersionId = &cachedModelFile.VersionId
+	} else if cachedFile != nil && cachedFile.FileIdentityHash == fileCache.FileIdentityHash {
+		// 文件内容没有变化，只是修改时间等指纹发生了变化时，保留原有的关联。
+		fileCache.RelatedModelVersionId = cachedFile.RelatedModelVersionId
 	}
-	var count int64
-	dbConn.Model(&entities.FileCache{}).Where("file_identity_hash = ?", fileCache.FileIdentityHash).Count(&count)
-	if count == 0 {
+	if cachedFile != nil {
+		dbConn.Save(&fileCache)
+		stats.countChanged()
+	} else {
+		var count int64
+		dbConn.Model(&entities.FileCache{}).Where("file_identity_hash = ?", fileCache.FileIdentityHash).Count(&count)
+		if count > 0 {
+			stats.countSkipped()
+			return
+		}
 		dbConn.Create(&fileCache)
+		stats.countCreated()
+	}
+	// 元数据只是附加信息，读取失败不影响文件记录。
+	if err := recordFileMetadata(ctx, fileCache.Id, filePath); err != nil {
+		runtime.LogErrorf(ctx, "提取文件 [%s] 元数据失败，%s", filePath, err)
+	}
+	if _, err := recordPickleScan(ctx, &fileCache); err != nil {
+		runtime.LogErrorf(ctx, "检查文件 [%s] pickle数据失败，%s", filePath, err)
+	}
+	if err := inferUnidentifiedFile(ctx, &fileCache); err != nil {
+		runtime.LogErrorf(ctx, "推断文件 [%s] 模型类型失败，%s", filePath, err)
+	}
+	logReindexError(ctx, reindexFileCaches(dbConn, fileCache.Id))
+	if exportUserMeta {
+		logWebUIUserMetaError(ctx, &fileCache, exportWebUIUserMeta(ctx, &fileCache))
 	}
 }
 
 // 返回值分别为伴随模型的缩略图路径和Civitai描述文件路径。需要传入的模型文件路径为绝对路径。如果模型没有对应的缩略图或描述文件，则返回nil。
-// 如果发现了多个对应的文件，则会返回最后发现的文件。
+// 陪同文件按照命名约定精确匹配，如果发现了多个对应的文件，则按照命名约定的优先顺序返回其中之一，完整的匹配结果可以通过`matchCompanionFiles`获取。
 func collectAccompanyFile(modelFilePath string) (*string, *string, error) {
-	modelFile, err := os.Stat(modelFilePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil, fmt.Errorf("模型文件不存在")
-		}
-		return nil, nil, fmt.Errorf("获取模型文件信息出错，%w", err)
-	}
-	modelDir := filepath.Dir(modelFilePath)
-	modelFileName := modelFile.Name()
-	ext := filepath.Ext(modelFileName)
-	modelFileBaseName := strings.ToLower(strings.TrimSuffix(modelFileName, ext))
-	var (
-		thumbnailPath   *string
-		descriptionPath *string
-	)
-	files, err := os.ReadDir(modelDir)
+	companions, err := matchCompanionFiles(modelFilePath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("获取模型文件所在目录文件列表出错，%w", err)
+		return nil, nil, err
 	}
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
-		fileName := strings.ToLower(file.Name())
-		if strings.HasPrefix(fileName, modelFileBaseName) {
-			if strings.HasSuffix(fileName, ".png") || strings.HasSuffix(fileName, ".jpg") || strings.HasSuffix(fileName, ".webp") {
-				absPath := filepath.Join(modelDir, file.Name())
-				thumbnailPath = &absPath
-			} else if strings.HasSuffix(fileName, ".civitai.info") {
-				absPath := filepath.Join(modelDir, file.Name())
-				descriptionPath = &absPath
-			}
-		}
-	}
-	return thumbnailPath, descriptionPath, nil
+	return companions.primary(CompanionThumbnail), companions.primary(CompanionCivitaiInfo), nil
 }
 
-// 对于文件是否是已经保存在数据库中的判断，是使用文件的完整绝对路径来实现的，因此，如果文件移动了位置，那么就会导致文件无法被正确识别。
-func searchUncachedFiles(ctx context.Context, files []string) ([]string, error) {
+// 对于文件是否是已经保存在数据库中的判断，是使用文件的完整绝对路径来实现的，移动了位置的文件会被列为未保存的文件，在扫描时再与原记录对应。
+// 已经保存过的文件还会比对文件指纹（大小、修改时间、Inode和设备编号），指纹发生变化的文件同样需要重新扫描。
+func searchUncachedFiles(ctx context.Context, stats *ScanStatistics, files []string) ([]string, error) {
 	var (
 		dbConn             = ctx.Value(db.DBConnection).(*gorm.DB)
 		uncachedFilePathes = make([]string, 0)
-		cachedFilePaths    = make([]string, 0)
+		cachedFiles        = make(map[string]entities.FileCache, 0)
 	)
 	fileGroups := lo.Chunk(files, 50)
 	for _, fileGroup := range fileGroups {
-		var cachedFiles []entities.FileCache
-		dbConn.Where("full_path IN ?", fileGroup).Find(&cachedFiles)
-		for _, filePath := range cachedFiles {
-			cachedFilePaths = append(cachedFilePaths, filePath.FullPath)
+		var caches []entities.FileCache
+		dbConn.Where("full_path IN ?", fileGroup).Find(&caches)
+		for _, cache := range caches {
+			cachedFiles[cache.FullPath] = cache
 		}
 	}
-	uncachedFilePathes = lo.Filter(files, func(item string, _ int) bool {
-		return !lo.Contains(cachedFilePaths, item)
-	})
+	for _, file := range files {
+		cache, ok := cachedFiles[file]
+		if !ok {
+			uncachedFilePathes = append(uncachedFilePathes, file)
+			continue
+		}
+		fingerprint, err := utils.StatFileFingerprint(file)
+		if err != nil {
+			stats.countFailed()
+			runtime.LogErrorf(ctx, "获取文件 [%s] 指纹失败，%s", file, err)
+			continue
+		}
+		if !isFingerprintRecorded(&cache) {
+			if err := backfillFingerprint(dbConn, cache.Id, fingerprint); err != nil {
+				runtime.LogErrorf(ctx, "补充文件 [%s] 指纹失败，%s", file, err)
+			}
+			if err := backfillLegacyCache(dbConn, &cache); err != nil {
+				runtime.LogErrorf(ctx, "补充文件 [%s] Hash失败，%s", file, err)
+			}
+			backfillClassification(ctx, &cache)
+			// 文件本身没有变化时，SD WebUI用户信息仍然可能在SD WebUI中被修改过。
+			logWebUIUserMetaError(ctx, &cache, refreshWebUIUserMeta(ctx, &cache))
+			stats.countSkipped()
+			continue
+		}
+		if isFingerprintMatched(&cache, fingerprint) {
+			if err := backfillLegacyCache(dbConn, &cache); err != nil {
+				runtime.LogErrorf(ctx, "补充文件 [%s] Hash失败，%s", file, err)
+			}
+			backfillClassification(ctx, &cache)
+			// 文件本身没有变化时，SD WebUI用户信息仍然可能在SD WebUI中被修改过。
+			logWebUIUserMetaError(ctx, &cache, refreshWebUIUserMeta(ctx, &cache))
+			stats.countSkipped()
+			continue
+		}
+		uncachedFilePathes = append(uncachedFilePathes, file)
+	}
 	return uncachedFilePathes, nil
 }
 
@@ -257,44 +336,56 @@ func searchModelInfo(ctx context.Context, files []string) ([]SimpleModelDescript
 		fileCache := make([]entities.FileCache, 0)
 		dbConn.Joins("RelatedModel").Joins("RelatedModel.Model").Where("full_path IN ?", fileGroup).Find(&fileCache)
 		for _, cache := range fileCache {
-			var (
-				relatedModel    *int
-				modelName       string
-				versionName     string
-				modelType       *string
-				nsfw            bool
-				activatePrompts = make([]string, 0)
-			)
-			if cache.RelatedModelVersionId != nil && cache.RelatedModel.Id != 0 {
-				modelName = cache.RelatedModel.Model.Name
-				versionName = cache.RelatedModel.VersionName
-				relatedModel = &cache.RelatedModel.Model.Id
-				modelType = &cache.RelatedModel.Model.Type
-				activatePrompts = cache.RelatedModel.ActivatePrompt
-				nsfw = *cache.RelatedModel.Model.NSFW
-
-			} else {
-				modelName = filepath.Base(cache.FullPath)
-				versionName = ""
-			}
-			description := SimpleModelDescript{
-				Id:             cache.Id,
-				Name:           modelName,
-				VersionName:    versionName,
-				NSFW:           nsfw,
-				FilePath:       cache.FullPath,
-				Type:           modelType,
-				ThumbnailPath:  cache.ThumbnailPath,
-				FileHash:       cache.FileIdentityHash,
-				ActivatePrompt: append(activatePrompts, cache.AdditionalPrompts...),
-				Memo:           cache.Memo,
-				BaseModel:      cache.BaseModel,
-				Related:        cache.RelatedModelVersionId != nil && *cache.RelatedModelVersionId != 0,
-				RelatedModel:   relatedModel,
-				RelatedVersion: cache.RelatedModelVersionId,
-			}
+			description := describeFileCache(cache)
 			descriptions = append(descriptions, description)
 		}
 	}
 	return descriptions, nil
 }
+
+// 将关联了模型信息的文件缓存记录转换为模型列表中使用的简要描述，文件缓存需要使用`RelatedModel`和`RelatedModel.Model`关联查询。
+func describeFileCache(cache entities.FileCache) SimpleModelDescript {
+	var (
+		relatedModel    *int
+		modelName       string
+		versionName     string
+		modelType       *string
+		nsfw            bool
+		commercialUse   *bool
+		activatePrompts = make([]string, 0)
+	)
+	if cache.RelatedModelVersionId != nil && cache.RelatedModel.Id != 0 {
+		modelName = cache.RelatedModel.Model.Name
+		versionName = cache.RelatedModel.VersionName
+		relatedModel = &cache.RelatedModel.Model.Id
+		modelType = &cache.RelatedModel.Model.Type
+		activatePrompts = cache.RelatedModel.ActivatePrompt
+		nsfw = *cache.RelatedModel.Model.NSFW
+		commercialUse = commercialUseAllowed(cache.RelatedModel.Model)
+
+	} else {
+		modelName = filepath.Base(cache.FullPath)
+		versionName = ""
+		modelType = cache.ModelType
+	}
+	return SimpleModelDescript{
+		Id:                  cache.Id,
+		Name:                modelName,
+		VersionName:         versionName,
+		NSFW:                nsfw,
+		FilePath:            cache.FullPath,
+		Type:                modelType,
+		ThumbnailPath:       cache.ThumbnailPath,
+		FileHash:            cache.FileIdentityHash,
+		ActivatePrompt:      append(activatePrompts, cache.AdditionalPrompts...),
+		Memo:                cache.Memo,
+		BaseModel:           cache.BaseModel,
+		BaseModelConfidence: cache.BaseModelConfidence,
+		TypeConfidence:      cache.ModelTypeConfidence,
+		PickleVerdict:       cache.PickleVerdict,
+		CommercialUse:       commercialUse,
+		Related:             cache.RelatedModelVersionId != nil && *cache.RelatedModelVersionId != 0,
+		RelatedModel:        relatedModel,
+		RelatedVersion:      cache.RelatedModelVersionId,
+	}
+}
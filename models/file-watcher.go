@@ -0,0 +1,315 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/config"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/vixalie/sd-content-manager/utils"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+const (
+	// 文件在最后一次变化之后需要保持稳定的时间，用于等待其他工具完成文件的写入。
+	watchSettleDelay = 3 * time.Second
+	// 文件被删除或者移出之后等待的时间，用于合并同一文件的多次事件。
+	watchRemoveDelay = 5 * time.Second
+	// 文件被删除或者移出之后保留文件记录的时间。文件被移动到其他监视目录时，需要等待新位置上的文件稳定之后才能识别为移动，
+	// 在这段时间内没有被识别为移动的文件记录将被删除。
+	watchMoveDetectWindow = 30 * time.Second
+)
+
+type WatchedFileEventPayload struct {
+	State string `json:"state"`
+	File  string `json:"file"`
+}
+
+// 对全部已配置的模型目录进行实时监视，其他工具下载或者删除的模型文件将会通过与`scanModelFile`相同的过程记录到数据库中。
+type modelFileWatcher struct {
+	ctx       context.Context
+	watcher   *fsnotify.Watcher
+	timers    map[string]*time.Timer
+	timerLock sync.Mutex
+	done      chan struct{}
+	dirs      []string // 监视的模型目录，用于判断配置变更之后是否需要重新建立监视。
+}
+
+var (
+	activeWatcher *modelFileWatcher
+	watcherLock   sync.Mutex
+)
+
+func managedModelDirPaths(ctx context.Context) []string {
+	return lo.Map(listManagedModelDirs(ctx), func(dir managedModelDir, _ int) string { return dir.Path })
+}
+
+// 启动模型目录监视，如果已经存在正在运行的监视，那么会首先将其停止，以便应用最新的目录配置。
+func startModelFileWatcher(ctx context.Context) error {
+	watcherLock.Lock()
+	defer watcherLock.Unlock()
+	return restartModelFileWatcher(ctx, managedModelDirPaths(ctx))
+}
+
+// 配置变更之后，只有可管理的模型目录发生了变化时才重新建立模型目录监视。
+func refreshModelFileWatcher(ctx context.Context) error {
+	watcherLock.Lock()
+	defer watcherLock.Unlock()
+	dirs := managedModelDirPaths(ctx)
+	if activeWatcher != nil {
+		added, removed := lo.Difference(dirs, activeWatcher.dirs)
+		if len(added) == 0 && len(removed) == 0 {
+			return nil
+		}
+	}
+	return restartModelFileWatcher(ctx, dirs)
+}
+
+// 调用者需要持有watcherLock。
+func restartModelFileWatcher(ctx context.Context, dirs []string) error {
+	if activeWatcher != nil {
+		activeWatcher.close()
+		activeWatcher = nil
+	}
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("无法创建文件监视器，%w", err)
+	}
+	w := &modelFileWatcher{
+		ctx:     ctx,
+		watcher: fsWatcher,
+		timers:  make(map[string]*time.Timer, 0),
+		done:    make(chan struct{}),
+		dirs:    dirs,
+	}
+	for _, dir := range dirs {
+		if err := w.watchRecursively(dir); err != nil {
+			runtime.LogWarningf(ctx, "无法监视模型目录 [%s]，%s", dir, err)
+		}
+	}
+	go w.run()
+	activeWatcher = w
+	runtime.LogInfof(ctx, "模型目录监视已启动，共监视 %d 个目录", len(fsWatcher.WatchList()))
+	return nil
+}
+
+func stopModelFileWatcher() {
+	watcherLock.Lock()
+	defer watcherLock.Unlock()
+	if activeWatcher != nil {
+		activeWatcher.close()
+		activeWatcher = nil
+	}
+}
+
+func (w *modelFileWatcher) close() {
+	close(w.done)
+	w.watcher.Close()
+	w.timerLock.Lock()
+	defer w.timerLock.Unlock()
+	for path, timer := range w.timers {
+		timer.Stop()
+		delete(w.timers, path)
+	}
+}
+
+// fsnotify不支持递归监视，所以需要将目录下的每一个子目录都加入监视。
+func (w *modelFileWatcher) watchRecursively(root string) error {
+	if _, err := os.Stat(root); err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if err := w.watcher.Add(path); err != nil {
+				runtime.LogWarningf(w.ctx, "无法监视目录 [%s]，%s", path, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (w *modelFileWatcher) run() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			runtime.LogErrorf(w.ctx, "模型目录监视出现错误，%s", err)
+		}
+	}
+}
+
+func isWatchedModelFile(path string) bool {
+	return lo.Contains(config.AllModelExtensions(), strings.ToLower(filepath.Ext(path)))
+}
+
+func isWebUIUserMetaFile(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".json"
+}
+
+func (w *modelFileWatcher) handleEvent(event fsnotify.Event) {
+	switch {
+	case event.Has(fsnotify.Create):
+		stat, err := os.Stat(event.Name)
+		if err != nil {
+			return
+		}
+		if stat.IsDir() {
+			// 新出现的目录可能是整体移动进来的，其中已经包含了模型文件。
+			w.watchRecursively(event.Name)
+			filepath.WalkDir(event.Name, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() && isWatchedModelFile(path) {
+					w.schedule(path, watchSettleDelay, func() { w.settle(path, nil) })
+				}
+				return nil
+			})
+			return
+		}
+		if isWatchedModelFile(event.Name) {
+			w.schedule(event.Name, watchSettleDelay, func() { w.settle(event.Name, nil) })
+		}
+		if isWebUIUserMetaFile(event.Name) {
+			w.schedule(event.Name, watchSettleDelay, func() { w.userMetaChanged(event.Name) })
+		}
+	case event.Has(fsnotify.Write):
+		if isWatchedModelFile(event.Name) {
+			w.schedule(event.Name, watchSettleDelay, func() { w.settle(event.Name, nil) })
+		}
+		if isWebUIUserMetaFile(event.Name) {
+			w.schedule(event.Name, watchSettleDelay, func() { w.userMetaChanged(event.Name) })
+		}
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		if isWatchedModelFile(event.Name) {
+			w.schedule(event.Name, watchRemoveDelay, func() { w.removed(event.Name) })
+		}
+	}
+}
+
+// 为指定文件安排一次延迟处理，同一文件上尚未执行的处理将被新的处理替代。
+func (w *modelFileWatcher) schedule(path string, delay time.Duration, action func()) {
+	w.timerLock.Lock()
+	defer w.timerLock.Unlock()
+	if timer, ok := w.timers[path]; ok {
+		timer.Stop()
+	}
+	w.timers[path] = time.AfterFunc(delay, action)
+}
+
+func (w *modelFileWatcher) unschedule(path string) {
+	w.timerLock.Lock()
+	defer w.timerLock.Unlock()
+	delete(w.timers, path)
+}
+
+// 只有在两次间隔检查中文件指纹都保持不变时，才认为文件已经写入完成，否则继续等待。
+func (w *modelFileWatcher) settle(path string, last *utils.FileFingerprint) {
+	fingerprint, err := utils.StatFileFingerprint(path)
+	if err != nil {
+		w.unschedule(path)
+		return
+	}
+	if last == nil || !last.Equal(*fingerprint) {
+		w.schedule(path, watchSettleDelay, func() { w.settle(path, fingerprint) })
+		return
+	}
+	w.unschedule(path)
+	w.process(path)
+}
+
+// 已经稳定的文件与列举模型文件时使用相同的处理过程，未发生变化的文件不会被重新扫描。
+func (w *modelFileWatcher) process(path string) {
+	var stats ScanStatistics
+	files, err := searchUncachedFiles(w.ctx, &stats, []string{path})
+	if err != nil {
+		runtime.LogErrorf(w.ctx, "检查监视到的文件 [%s] 失败，%s", path, err)
+		return
+	}
+	if len(files) == 0 {
+		return
+	}
+	// 监视到的文件与其他扫描任务共用所在存储设备的读取调度。
+	device := fileIOScheduler.deviceOf(path)
+	if err := device.acquire(w.ctx); err != nil {
+		runtime.LogErrorf(w.ctx, "无法执行监视文件扫描过程控制，%s", err)
+		return
+	}
+	scanModelFile(w.ctx, &stats, path)
+	device.release()
+	runtime.LogInfof(w.ctx, "已记录监视到的模型文件 [%s]", path)
+	runtime.EventsEmit(w.ctx, "model-file-watched", WatchedFileEventPayload{State: "created", File: path})
+}
+
+// SD WebUI中修改的用户信息同步到对应的文件记录，没有对应已记录模型文件的JSON文件会被忽略。
+func (w *modelFileWatcher) userMetaChanged(metaPath string) {
+	w.unschedule(metaPath)
+	dbConn := w.ctx.Value(db.DBConnection).(*gorm.DB)
+	baseName := strings.TrimSuffix(metaPath, filepath.Ext(metaPath))
+	candidates := lo.Map(config.AllModelExtensions(), func(ext string, _ int) string {
+		return baseName + ext
+	})
+	var caches []entities.FileCache
+	if result := dbConn.Where("full_path IN ?", candidates).Find(&caches); result.Error != nil {
+		runtime.LogErrorf(w.ctx, "查询用户信息文件 [%s] 对应的模型文件失败，%s", metaPath, result.Error)
+		return
+	}
+	for _, cache := range caches {
+		logWebUIUserMetaError(w.ctx, &cache, refreshWebUIUserMeta(w.ctx, &cache))
+	}
+}
+
+// 被删除的文件首先向前端发出通知，文件记录会再保留一段时间，以便文件在其他位置出现时可以作为移动的文件识别。
+func (w *modelFileWatcher) removed(path string) {
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		w.unschedule(path)
+		return
+	}
+	runtime.LogInfof(w.ctx, "监视到模型文件 [%s] 已被删除或移出", path)
+	runtime.EventsEmit(w.ctx, "model-file-watched", WatchedFileEventPayload{State: "removed", File: path})
+	w.schedule(path, watchMoveDetectWindow, func() { w.purge(path) })
+}
+
+// 删除在等待期间既没有重新出现、也没有被识别为移动的文件的记录及其检索索引。
+// 被识别为移动的文件记录已经更新为新的路径，所以不会被删除。
+func (w *modelFileWatcher) purge(path string) {
+	w.unschedule(path)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	dbConn := w.ctx.Value(db.DBConnection).(*gorm.DB)
+	var cacheIds []string
+	if result := dbConn.Model(&entities.FileCache{}).Where("full_path = ?", path).Pluck("id", &cacheIds); result.Error != nil {
+		runtime.LogErrorf(w.ctx, "查询被删除的文件 [%s] 记录失败，%s", path, result.Error)
+		return
+	}
+	if len(cacheIds) == 0 {
+		return
+	}
+	if err := deleteFileCaches(dbConn, cacheIds...); err != nil {
+		runtime.LogErrorf(w.ctx, "删除被删除的文件 [%s] 记录失败，%s", path, err)
+		return
+	}
+	runtime.LogInfof(w.ctx, "已删除被删除的模型文件 [%s] 的记录", path)
+	runtime.EventsEmit(w.ctx, "model-file-watched", WatchedFileEventPayload{State: "purged", File: path})
+}
@@ -9,132 +9,233 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
-	"archgrid.xyz/ag/toolsbox/hash/crc32"
 	"archgrid.xyz/ag/toolsbox/hash/sha256"
 	"archgrid.xyz/ag/toolsbox/serial_code/hail"
-	"archgrid.xyz/ag/toolsbox/serialize/hex"
 	"github.com/samber/lo"
 	"github.com/vixalie/sd-content-manager/config"
 	"github.com/vixalie/sd-content-manager/db"
 	"github.com/vixalie/sd-content-manager/entities"
 	"github.com/vixalie/sd-content-manager/utils"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
-	"golang.org/x/sync/semaphore"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 var (
 	scanableModelTypes = []string{"checkpoint", "hypernet", "embedding", "lora", "locon", "vae", "controlnet", "upscaler"}
 )
 
-func fullScanEverything(ctx context.Context) error {
-	for _, uiTool := range []string{"comfyui", "webui"} {
-		runtime.LogDebugf(ctx, "正在扫描: %s\n", uiTool)
-		err := scanSoftware(ctx, uiTool)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+// 一个需要扫描的模型文件。如果扫描任务存在对应的扫描计划，那么还会记录其在扫描计划中的条目编号。
+type scanTarget struct {
+	ModelType  string
+	Path       string
+	Size       int64
+	PlanItemId int64
 }
 
-func scanSoftware(ctx context.Context, uiTools string) error {
-	for _, modelType := range scanableModelTypes {
-		runtime.LogDebugf(ctx, "正在扫描: [%s] %s", uiTools, modelType)
-		err := scanModel(ctx, uiTools, modelType)
-		if err != nil {
-			runtime.LogErrorf(ctx, "扫描指定类型模型目录出错，%s", err)
-			return fmt.Errorf("扫描指定类型模型目录出错，%w", err)
-		}
+// 遍历给定的模型目录及其全部子目录，收集所有需要扫描的模型文件。
+func collectScanTargets(dirs []managedModelDir) []scanTarget {
+	var targets = make([]scanTarget, 0)
+	for _, dir := range dirs {
+		filepath.WalkDir(dir.Path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			fileExt := strings.ToLower(filepath.Ext(d.Name()))
+			if !config.IsModelExtension(dir.ModelType, fileExt) {
+				return nil
+			}
+			var size int64
+			if info, err := d.Info(); err == nil {
+				size = info.Size()
+			}
+			targets = append(targets, scanTarget{ModelType: dir.ModelType, Path: path, Size: size})
+			return nil
+		})
 	}
-	return nil
+	return targets
 }
 
-func scanModel(ctx context.Context, uiTools, modelType string) error {
-	var targetScanDir []string
-	switch config.MatchSoftware(uiTools) {
-	case config.ComfyUI:
-		targetScanDir, _ = config.GetComfyModelPath(modelType)
-	case config.WebUI:
-		targetScanDir, _ = config.GetWebUIModelPath(modelType)
+func sumScanTargetSize(targets []scanTarget) int64 {
+	return lo.SumBy(targets, func(target scanTarget) int64 {
+		return target.Size
+	})
+}
+
+// 全面扫描开始之前会将需要扫描的文件列表保存为扫描计划，应用在扫描过程中退出之后，可以从扫描计划中继续未完成的扫描。
+func fullScanEverything(ctx context.Context) error {
+	job, err := registerScanJob(ctx, ScanJobFullScan)
+	if err != nil {
+		return err
 	}
-	var (
-		scanQueue = make(chan string, 500)
-		semaphore = semaphore.NewWeighted(10)
-		wg        sync.WaitGroup
-	)
-	go scanDir(scanQueue, targetScanDir)
-	for dir := range scanQueue {
-		runtime.LogDebugf(ctx, "正在扫描文件：[%s][%s] %s", uiTools, modelType, dir)
-		if err := semaphore.Acquire(ctx, 1); err != nil {
-			runtime.LogErrorf(ctx, "无法执行扫描过程控制，%s", err)
-			return fmt.Errorf("无法执行扫描过程控制，%w", err)
-		}
-		wg.Add(1)
-		// 调用简易模型扫描函数，放入文件的绝对路径
-		go simplifiedScanModelFiles(ctx, semaphore, &wg, modelType, dir)
+	dirs := listManagedModelDirs(ctx)
+	plan, items, err := createScanPlan(ctx, ScanJobFullScan, dirs, collectScanTargets(dirs))
+	if err != nil {
+		job.finish(err)
+		return err
 	}
-	wg.Wait()
-	return nil
+	err = runFullScan(job, plan, items)
+	finishScanPlan(ctx, job, plan.Id, err)
+	return err
 }
 
-func scanDir(queue chan string, targetDirs []string) {
-	for _, dir := range targetDirs {
-		// 扫描指定目录下的所有子目录，将所有的子目录都放入扫描队列中，将对所有的文件调用模型扫描函数
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			return
-		}
-		for _, entry := range entries {
-			filepath.WalkDir(filepath.Join(dir, entry.Name()), func(path string, d fs.DirEntry, err error) error {
-				if !d.IsDir() {
-					fileExt := strings.ToLower(filepath.Ext(d.Name()))
-					if lo.Contains(modelExts, fileExt) {
-						queue <- path
-					}
-				}
-				return nil
-			})
-		}
+// 执行扫描计划中尚未完成的部分。
+func runFullScan(job *ScanJob, plan *entities.ScanPlan, items []entities.ScanPlanItem) error {
+	var (
+		ctx      = job.ctx
+		stats    ScanStatistics
+		recorder = newScanPlanRecorder(ctx, plan.Id)
+	)
+	job.attachPlan(recorder)
+	job.setTotal(int64(len(items)), lo.SumBy(items, func(item entities.ScanPlanItem) int64 {
+		return item.Size
+	}))
+	finishedItems := lo.Filter(items, func(item entities.ScanPlanItem, _ int) bool {
+		return item.Done
+	})
+	job.restoreProgress(int64(len(finishedItems)), lo.SumBy(finishedItems, func(item entities.ScanPlanItem) int64 {
+		return item.Size
+	}))
+	targets := lo.FilterMap(items, func(item entities.ScanPlanItem, _ int) (scanTarget, bool) {
+		return scanTarget{ModelType: item.ModelType, Path: item.FullPath, Size: item.Size, PlanItemId: item.Id}, !item.Done
+	})
+	// 文件按照所在的存储设备分组扫描，每个设备同时扫描的文件数量由文件读取调度配置决定。
+	scanErr := scheduleByDevice(ctx, targets, func(target scanTarget) string {
+		return target.Path
+	}, job.waitIfPaused, func(target scanTarget) {
+		runtime.LogDebugf(ctx, "正在扫描文件：[%s] %s", target.ModelType, target.Path)
+		simplifiedScanModelFiles(ctx, &stats, job, target)
+	})
+	if scanErr != nil && ctx.Err() != nil {
+		scanErr = ErrScanJobCanceled
+	} else if scanErr != nil && !errors.Is(scanErr, ErrScanJobCanceled) {
+		runtime.LogErrorf(ctx, "无法执行扫描过程控制，%s", scanErr)
+		scanErr = fmt.Errorf("无法执行扫描过程控制，%w", scanErr)
 	}
-	close(queue)
+	recorder.flush()
+	summary := stats.Snapshot()
+	runtime.LogInfof(ctx, "全面扫描结束，跳过 %d 个未变化文件，重新扫描 %d 个已变化文件，新增 %d 个文件，移动 %d 个文件，失败 %d 个文件", summary.Skipped, summary.Changed, summary.Created, summary.Moved, summary.Failed)
+	runtime.EventsEmit(ctx, "mass-scan-summary", summary)
+	return scanErr
 }
 
-func simplifiedScanModelFiles(ctx context.Context, weighted *semaphore.Weighted, wg *sync.WaitGroup, modelType, targetFilePath string) {
-	defer weighted.Release(1)
-	defer wg.Done()
+func simplifiedScanModelFiles(ctx context.Context, stats *ScanStatistics, job *ScanJob, target scanTarget) {
+	modelType, targetFilePath := target.ModelType, target.Path
+	defer job.advance(target)
 	defer runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "end", "file": targetFilePath})
 	runtime.LogDebugf(ctx, "Scanning model: [%s] %s", modelType, targetFilePath)
 
 	runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "start", "file": targetFilePath})
 
-	fileHash, err := sha256.SumFile256Hex(targetFilePath)
+	fingerprint, err := utils.StatFileFingerprint(targetFilePath)
 	if err != nil {
-		runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "error", "file": targetFilePath, "message": "无法计算文件哈希值"})
-		runtime.LogErrorf(ctx, "计算文件哈希值失败，%s", err)
+		stats.countFailed()
+		runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "error", "file": targetFilePath, "message": "无法获取文件信息"})
+		runtime.LogErrorf(ctx, "获取文件信息失败，%s", err)
 		return
 	}
 	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
 
-	// 根据文件Hash检查文件是否已经被记录过了
-	var count int64
-	result := dbConn.Model(&entities.FileCache{}).Where("file_identity_hash = ?", fileHash).Count(&count)
-	if result.Error != nil {
+	// 首先根据文件路径检查文件是否已经被记录过了，已经记录过的文件利用文件指纹判断是否需要重新计算Hash。
+	var cachedFile *entities.FileCache
+	var existsCache entities.FileCache
+	result := dbConn.Where("full_path = ?", targetFilePath).First(&existsCache)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		stats.countFailed()
 		runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "error", "file": targetFilePath, "message": "无法查询文件是否已经被记录"})
 		runtime.LogErrorf(ctx, "查询文件是否已经被记录失败，%s", result.Error)
 		return
 	}
-	if count > 0 {
-		runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "skip", "file": targetFilePath, "message": "文件已经被记录"})
-		runtime.LogInfof(ctx, "文件 [%s] 已经被记录，跳过", targetFilePath)
+	if result.Error == nil {
+		if !isFingerprintRecorded(&existsCache) {
+			if err := backfillFingerprint(dbConn, existsCache.Id, fingerprint); err != nil {
+				runtime.LogErrorf(ctx, "补充文件 [%s] 指纹失败，%s", targetFilePath, err)
+			}
+		}
+		if !isFingerprintRecorded(&existsCache) || isFingerprintMatched(&existsCache, fingerprint) {
+			if err := backfillLegacyCache(dbConn, &existsCache); err != nil {
+				runtime.LogErrorf(ctx, "补充文件 [%s] Hash失败，%s", targetFilePath, err)
+			}
+			// 在pickle安全检查出现之前记录的PyTorch文件需要补充检查。
+			if needsPickleScan(&existsCache) {
+				if _, err := recordPickleScan(ctx, &existsCache); err != nil {
+					runtime.LogErrorf(ctx, "检查文件 [%s] pickle数据失败，%s", targetFilePath, err)
+				}
+			}
+			backfillClassification(ctx, &existsCache)
+			logWebUIUserMetaError(ctx, &existsCache, refreshWebUIUserMeta(ctx, &existsCache))
+			stats.countSkipped()
+			runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "skip", "file": targetFilePath, "message": "文件未发生变化"})
+			runtime.LogInfof(ctx, "文件 [%s] 未发生变化，跳过", targetFilePath)
+			return
+		}
+		cachedFile = &existsCache
+	} else {
+		// 未记录过的路径首先尝试使用文件指纹识别被移动或者重命名的文件。
+		movedFile, err := findMovedFileByFingerprint(ctx, targetFilePath, fingerprint)
+		if err != nil {
+			runtime.LogErrorf(ctx, "检查文件 [%s] 是否被移动失败，%s", targetFilePath, err)
+		}
+		if movedFile != nil {
+			if err := relocateFileCache(ctx, movedFile, targetFilePath, fingerprint); err != nil {
+				stats.countFailed()
+				runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "error", "file": targetFilePath, "message": "无法更新被移动的文件记录"})
+				runtime.LogErrorf(ctx, "更新被移动的文件 [%s] 记录失败，%s", targetFilePath, err)
+				return
+			}
+			stats.countMoved()
+			runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "moved", "file": targetFilePath, "message": "文件已被移动"})
+			return
+		}
+	}
+
+	fileHashes, err := computeFileHashes(ctx, targetFilePath, fingerprint)
+	if err != nil {
+		stats.countFailed()
+		runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "error", "file": targetFilePath, "message": "无法计算文件哈希值"})
+		runtime.LogErrorf(ctx, "计算文件哈希值失败，%s", err)
 		return
 	}
 
+	if cachedFile == nil {
+		// 根据文件Hash检查文件是否是从已经不存在的位置移动过来的
+		movedFile, err := findMovedFileByHash(ctx, targetFilePath, fileHashes.SHA256)
+		if err != nil {
+			runtime.LogErrorf(ctx, "检查文件 [%s] 是否被移动失败，%s", targetFilePath, err)
+		}
+		if movedFile != nil {
+			if err := relocateFileCache(ctx, movedFile, targetFilePath, fingerprint); err != nil {
+				stats.countFailed()
+				runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "error", "file": targetFilePath, "message": "无法更新被移动的文件记录"})
+				runtime.LogErrorf(ctx, "更新被移动的文件 [%s] 记录失败，%s", targetFilePath, err)
+				return
+			}
+			stats.countMoved()
+			runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "moved", "file": targetFilePath, "message": "文件已被移动"})
+			return
+		}
+		// 根据文件Hash检查文件是否已经在其他位置被记录过了
+		var count int64
+		result = dbConn.Model(&entities.FileCache{}).Where("file_identity_hash = ?", fileHashes.SHA256).Count(&count)
+		if result.Error != nil {
+			stats.countFailed()
+			runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "error", "file": targetFilePath, "message": "无法查询文件是否已经被记录"})
+			runtime.LogErrorf(ctx, "查询文件是否已经被记录失败，%s", result.Error)
+			return
+		}
+		if count > 0 {
+			stats.countSkipped()
+			runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "skip", "file": targetFilePath, "message": "文件已经被记录"})
+			runtime.LogInfof(ctx, "文件 [%s] 已经被记录，跳过", targetFilePath)
+			return
+		}
+	}
+
 	// 收集所有扫描文件和模型信息需要的陪同文件
 	thumbnailPath, descriptionPath, err := collectAccompanyFile(targetFilePath)
 	if err != nil {
+		stats.countFailed()
 		runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "error", "file": targetFilePath, "message": "无法收集文件陪同文件"})
 		runtime.LogErrorf(ctx, "收集文件 [%s] 陪同文件失败，%s", targetFilePath, err)
 		return
@@ -143,6 +244,7 @@ func simplifiedScanModelFiles(ctx context.Context, weighted *semaphore.Weighted,
 	if thumbnailPath != nil {
 		hash, err := utils.PHashImage(*thumbnailPath)
 		if err != nil {
+			stats.countFailed()
 			runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "error", "file": targetFilePath, "message": "无法计算文件缩略图哈希值"})
 			runtime.LogErrorf(ctx, "计算文件 [%s] 缩略图哈希值失败，%s", targetFilePath, err)
 			return
@@ -150,12 +252,6 @@ func simplifiedScanModelFiles(ctx context.Context, weighted *semaphore.Weighted,
 		thumbnailHash = &hash
 	}
 	fileBaseName := filepath.Base(targetFilePath)
-	fileCrc32, err := crc32.SumFile(targetFilePath)
-	if err != nil {
-		runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "error", "file": targetFilePath, "message": "无法计算文件CRC32值"})
-		runtime.LogErrorf(ctx, "计算文件 [%s] CRC32 值失败，%s", targetFilePath, err)
-		return
-	}
 	var modelDescription *ModelVersion
 	if descriptionPath != nil {
 		// 这里处理的是Civitai Info文件已经被发现的情形。
@@ -174,25 +270,71 @@ func simplifiedScanModelFiles(ctx context.Context, weighted *semaphore.Weighted,
 		// 这里继续保存从模型Version中可以提取的各种信息。
 	}
 TERMINATE_PARSE:
-	// 处理实际的文件信息，将文件保存到数据库的FileCache中。
-	fileInfo, _ := os.Stat(targetFilePath)
+	// 处理实际的文件信息，将文件保存到数据库的FileCache中。已经记录过的文件将在原记录上更新，以保留用户记录的备注和提示词等内容。
 	hail := ctx.Value("hail").(*hail.HailAlgorithm)
 	fileCache := entities.FileCache{
-		Id:               hail.GeneratePrefixedString("F"),
-		FileIdentityHash: strings.ToUpper(fileHash),
-		FileName:         fileBaseName,
-		FullPath:         targetFilePath,
-		ThumbnailPath:    thumbnailPath,
-		ThumbnailPHash:   thumbnailHash,
-		CivitaiInfoPath:  descriptionPath,
-		Size:             uint64(fileInfo.Size()),
-		CRC32:            strings.ToUpper(hex.ToHex(lo.Reverse(fileCrc32))), // 这里需要转换成小端序，还需要转换成大写形式。
+		Id: hail.GeneratePrefixedString("F"),
+	}
+	if cachedFile != nil {
+		fileCache = *cachedFile
+	}
+	fileCache.FileName = fileBaseName
+	fileCache.FullPath = targetFilePath
+	fileCache.ThumbnailPath = thumbnailPath
+	fileCache.ThumbnailPHash = thumbnailHash
+	fileCache.CivitaiInfoPath = descriptionPath
+	applyFileHashes(&fileCache, fileHashes)
+	fileCache.Format = detectFileFormat(ctx, targetFilePath)
+	fileCache.RelatedModelVersionId = nil
+	applyFingerprint(&fileCache, fingerprint)
+	_, exportUserMeta, err := importWebUIUserMeta(&fileCache)
+	if err != nil {
+		runtime.LogErrorf(ctx, "读取文件 [%s] 的SD WebUI用户信息失败，%s", targetFilePath, err)
 	}
 	if modelDescription != nil && modelDescription.Id != 0 {
 		// 当模型描述不等于空的时候，需要向文件中登记其对应的模型信息。
 		fileCache.RelatedModelVersionId = &modelDescription.Id
+	} else {
+		// 没有Civitai Info文件时，与单独扫描文件时一样根据文件Hash查找已经记录的Civitai模型文件。
+		var cachedModelFile entities.ModelFile
+		if dbConn.Where(&entities.ModelFile{IdentityHash: fileCache.FileIdentityHash}).Limit(1).Find(&cachedModelFile).RowsAffected > 0 {
+			fileCache.RelatedModelVersionId = &cachedModelFile.VersionId
+		} else if cachedFile != nil && cachedFile.FileIdentityHash == fileCache.FileIdentityHash {
+			// 文件内容没有变化，只是修改时间等指纹发生了变化时，保留原有的关联。
+			fileCache.RelatedModelVersionId = cachedFile.RelatedModelVersionId
+		}
+	}
+	if cachedFile != nil {
+		result = dbConn.Save(&fileCache)
+	} else {
+		// 前面已经确认过没有记录Hash相同的文件。
+		result = dbConn.Create(&fileCache)
+	}
+	if result.Error != nil || result.RowsAffected == 0 {
+		stats.countFailed()
+		runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "error", "file": targetFilePath, "message": "无法保存文件记录"})
+		runtime.LogErrorf(ctx, "保存文件 [%s] 记录失败，%v", targetFilePath, result.Error)
+		return
+	}
+	if cachedFile != nil {
+		stats.countChanged()
+	} else {
+		stats.countCreated()
+	}
+	// 元数据只是附加信息，读取失败不影响文件记录。
+	if err := recordFileMetadata(ctx, fileCache.Id, targetFilePath); err != nil {
+		runtime.LogErrorf(ctx, "提取文件 [%s] 元数据失败，%s", targetFilePath, err)
+	}
+	if _, err := recordPickleScan(ctx, &fileCache); err != nil {
+		runtime.LogErrorf(ctx, "检查文件 [%s] pickle数据失败，%s", targetFilePath, err)
+	}
+	if err := inferUnidentifiedFile(ctx, &fileCache); err != nil {
+		runtime.LogErrorf(ctx, "推断文件 [%s] 模型类型失败，%s", targetFilePath, err)
+	}
+	logReindexError(ctx, reindexFileCaches(dbConn, fileCache.Id))
+	if exportUserMeta {
+		logWebUIUserMetaError(ctx, &fileCache, exportWebUIUserMeta(ctx, &fileCache))
 	}
-	dbConn.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "file_identity_hash"}}, DoNothing: true}).Create(&fileCache)
 	runtime.EventsEmit(ctx, "mass-scan-file", map[string]string{"state": "done", "file": targetFilePath})
 }
 
@@ -203,6 +345,7 @@ type DuplicateFile struct {
 	InfoPath      *string `json:"infoPath"`
 	Hash          string  `json:"hash"`
 	CacheId       *string `json:"cacheId"`
+	PickleVerdict *string `json:"pickleVerdict"` // 本地pickle安全检查的结论，不是PyTorch格式的文件为空。
 }
 
 type DuplicateRecord struct {
@@ -212,29 +355,45 @@ type DuplicateRecord struct {
 	Files   []DuplicateFile        `json:"files"`
 }
 
+// 最近一次完成的重复文件扫描结果。扫描时不会为重复的文件建立记录，磁盘用量分析需要借助这一结果计算重复文件占用的空间。
+var lastDuplicateScan struct {
+	lock      sync.Mutex
+	records   []DuplicateRecord
+	scannedAt *time.Time
+}
+
 func scanDuplicateModelFiles(ctx context.Context) ([]DuplicateRecord, error) {
+	job, err := registerScanJob(ctx, ScanJobDuplicateScan)
+	if err != nil {
+		return nil, err
+	}
+	records, err := runDuplicateScan(job)
+	job.finish(err)
+	if err == nil {
+		lastDuplicateScan.lock.Lock()
+		lastDuplicateScan.records = records
+		lastDuplicateScan.scannedAt = lo.ToPtr(time.Now())
+		lastDuplicateScan.lock.Unlock()
+	}
+	return records, err
+}
+
+func runDuplicateScan(job *ScanJob) ([]DuplicateRecord, error) {
 	var (
+		ctx        = job.ctx
 		duplicates = make(map[string][]string, 0)
-		allDirs    = make([]string, 0)
-		scanQueue  = make(chan string, 500)
 	)
-	// 缓存需要扫描的初始目录集合
-	for _, ui := range []string{"comfyui", "webui"} {
-		for _, modelType := range scanableModelTypes {
-			var targetScanDir []string
-			switch config.MatchSoftware(ui) {
-			case config.ComfyUI:
-				targetScanDir, _ = config.GetComfyModelPath(modelType)
-			case config.WebUI:
-				targetScanDir, _ = config.GetWebUIModelPath(modelType)
-			}
-			allDirs = append(allDirs, targetScanDir...)
-		}
-	}
-	go scanDir(scanQueue, allDirs)
+	// 缓存需要扫描的全部文件
+	targets := collectScanTargets(listManagedModelDirs(ctx))
+	job.setTotal(int64(len(targets)), sumScanTargetSize(targets))
 	// 开始扫描
-	for dir := range scanQueue {
+	for _, target := range targets {
+		if err := job.waitIfPaused(); err != nil {
+			return nil, err
+		}
+		dir := target.Path
 		fileHash, err := sha256.SumFile256Hex(dir)
+		job.advance(target)
 		if err != nil {
 			runtime.LogErrorf(ctx, "计算文件 [%s] 哈希值失败，%s", dir, err)
 			continue
@@ -249,6 +408,10 @@ func scanDuplicateModelFiles(ctx context.Context) ([]DuplicateRecord, error) {
 	var duplicateRecords = make([]DuplicateRecord, 0)
 	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
 	for hash, files := range duplicates {
+		// 只有一个文件的Hash不构成重复，不需要检索文件信息，也不需要进行pickle检查。
+		if len(files) < 2 {
+			continue
+		}
 		// 检索Hash重复的各个文件的信息，形成DuplicateFile记录
 		duplicatedFiles := lo.Map(files, func(file string, _ int) DuplicateFile {
 			fileRecord := DuplicateFile{
@@ -264,6 +427,13 @@ func scanDuplicateModelFiles(ctx context.Context) ([]DuplicateRecord, error) {
 			result := dbConn.Model(&entities.FileCache{}).Where("full_path = ?", file).First(&cacheRecord)
 			if !errors.Is(result.Error, gorm.ErrRecordNotFound) || result.Error == nil {
 				fileRecord.CacheId = &cacheRecord.Id
+				fileRecord.PickleVerdict = cacheRecord.PickleVerdict
+			}
+			// 尚未记录或者尚未检查的文件直接进行检查，但不保存结论。
+			if fileRecord.PickleVerdict == nil {
+				if scanResult, err := utils.ScanPickleFile(file); err == nil && scanResult != nil {
+					fileRecord.PickleVerdict = &scanResult.Verdict
+				}
 			}
 
 			return fileRecord
@@ -279,9 +449,7 @@ func scanDuplicateModelFiles(ctx context.Context) ([]DuplicateRecord, error) {
 			record.Model = file.Version.Model
 			record.Version = file.Version
 		}
-		if len(record.Files) > 1 {
-			duplicateRecords = append(duplicateRecords, record)
-		}
+		duplicateRecords = append(duplicateRecords, record)
 	}
 	return duplicateRecords, nil
 }
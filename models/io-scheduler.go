@@ -0,0 +1,225 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vixalie/sd-content-manager/config"
+	"github.com/vixalie/sd-content-manager/utils"
+	"golang.org/x/sync/semaphore"
+)
+
+// 设备读取速度的最短采样间隔。
+const deviceThroughputInterval = time.Second
+
+// 一个存储设备上的文件读取调度。同一设备上同时读取的文件数量受到限制，以免机械硬盘因为频繁寻道而降低速度。
+type ioDevice struct {
+	info              utils.BlockDevice
+	concurrency       int
+	concurrencySource string
+	weighted          *semaphore.Weighted
+	active            int64
+	bytesRead         int64
+	sampleLock        sync.Mutex
+	sampleBytes       int64
+	sampleAt          time.Time
+	throughput        float64
+}
+
+// 一个存储设备的读取状况，随扫描事件一同发送给前端。
+type DeviceThroughput struct {
+	Device      string `json:"device"`
+	Rotational  bool   `json:"rotational"`
+	Known       bool   `json:"known"` // 是否能够判断设备类型，无法判断的设备使用单独配置的并发数量。
+	Concurrency int    `json:"concurrency"`
+	// 并发数量的来源，取值为configured、rotational、solid-state、unknown。为unknown时可以在配置中为设备单独设置并发数量。
+	ConcurrencySource string  `json:"concurrencySource"`
+	Active            int64   `json:"active"`     // 正在读取的文件数量。
+	BytesRead         int64   `json:"bytesRead"`  // 自应用启动或者配置变更以来读取的字节数量。
+	Throughput        float64 `json:"throughput"` // 最近一段时间每秒读取的字节数量。
+}
+
+type ioScheduler struct {
+	lock    sync.Mutex
+	devices map[int64]*ioDevice
+}
+
+var fileIOScheduler = &ioScheduler{devices: make(map[int64]*ioDevice)}
+
+// 并发数量的来源。
+const (
+	concurrencyConfigured = "configured"
+	concurrencyRotational = "rotational"
+	concurrencySolidState = "solid-state"
+	concurrencyUnknown    = "unknown"
+)
+
+// 确定设备上同时读取的文件数量及其来源，配置中为设备单独设置的数量优先。
+func resolveDeviceConcurrency(info utils.BlockDevice, settings config.IOConfig) (int, string) {
+	for dir, concurrency := range settings.DeviceConcurrency {
+		if device, err := utils.FileDeviceId(dir); err == nil && device == info.Id {
+			return concurrency, concurrencyConfigured
+		}
+	}
+	switch {
+	case !info.Known:
+		return settings.UnknownConcurrency, concurrencyUnknown
+	case info.Rotational:
+		return settings.RotationalConcurrency, concurrencyRotational
+	default:
+		return settings.SolidStateConcurrency, concurrencySolidState
+	}
+}
+
+// 获取指定编号存储设备的调度，第一次使用时会检测设备类型。
+func (s *ioScheduler) device(deviceId int64) *ioDevice {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if device, ok := s.devices[deviceId]; ok {
+		return device
+	}
+	info := utils.DescribeBlockDevice(deviceId)
+	concurrency, source := resolveDeviceConcurrency(info, config.IOSettings())
+	device := &ioDevice{
+		info:              info,
+		concurrency:       concurrency,
+		concurrencySource: source,
+		weighted:          semaphore.NewWeighted(int64(concurrency)),
+		sampleAt:          time.Now(),
+	}
+	s.devices[deviceId] = device
+	return device
+}
+
+// 获取文件所在存储设备的调度，无法获取文件信息时使用编号为0的设备。
+func (s *ioScheduler) deviceOf(path string) *ioDevice {
+	deviceId, _ := utils.FileDeviceId(path)
+	return s.device(deviceId)
+}
+
+// 配置变更之后丢弃已有的设备调度，正在进行的读取会在原有的调度上完成。
+func (s *ioScheduler) reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.devices = make(map[int64]*ioDevice)
+}
+
+func (s *ioScheduler) metrics() []DeviceThroughput {
+	s.lock.Lock()
+	devices := make([]*ioDevice, 0, len(s.devices))
+	for _, device := range s.devices {
+		devices = append(devices, device)
+	}
+	s.lock.Unlock()
+	metrics := make([]DeviceThroughput, 0, len(devices))
+	for _, device := range devices {
+		metrics = append(metrics, device.snapshot())
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Device < metrics[j].Device
+	})
+	return metrics
+}
+
+func (d *ioDevice) acquire(ctx context.Context) error {
+	if err := d.weighted.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	atomic.AddInt64(&d.active, 1)
+	return nil
+}
+
+func (d *ioDevice) release() {
+	atomic.AddInt64(&d.active, -1)
+	d.weighted.Release(1)
+}
+
+func (d *ioDevice) countRead(n int) {
+	atomic.AddInt64(&d.bytesRead, int64(n))
+}
+
+// 获取设备当前的读取状况，读取速度按照采样间隔内读取的数据量计算。
+func (d *ioDevice) snapshot() DeviceThroughput {
+	bytesRead := atomic.LoadInt64(&d.bytesRead)
+	active := atomic.LoadInt64(&d.active)
+	d.sampleLock.Lock()
+	if elapsed := time.Since(d.sampleAt); elapsed >= deviceThroughputInterval {
+		d.throughput = float64(bytesRead-d.sampleBytes) / elapsed.Seconds()
+		d.sampleBytes = bytesRead
+		d.sampleAt = time.Now()
+	}
+	if active == 0 && bytesRead == d.sampleBytes {
+		d.throughput = 0
+	}
+	throughput := d.throughput
+	d.sampleLock.Unlock()
+	return DeviceThroughput{
+		Device:            d.info.Name,
+		Rotational:        d.info.Rotational,
+		Known:             d.info.Known,
+		Concurrency:       d.concurrency,
+		ConcurrencySource: d.concurrencySource,
+		Active:            active,
+		BytesRead:         bytesRead,
+		Throughput:        throughput,
+	}
+}
+
+// 计算Hash时使用的读取选项，读取的数据量会计入文件所在设备的统计。
+func (d *ioDevice) hashOptions() utils.HashOptions {
+	readAhead := int64(config.IOSettings().ReadAheadMB) * 1024 * 1024
+	return utils.HashOptions{
+		ReadAheadBytes: readAhead,
+		OnRead:         d.countRead,
+	}
+}
+
+// 按照文件所在的存储设备对任务进行分组，每个设备使用独立的协程派发任务，设备之间互不阻塞。
+// beforeEach在每个任务派发之前调用，返回错误时该设备停止派发后续任务。全部任务完成之后返回第一个派发错误。
+func scheduleByDevice[T any](ctx context.Context, items []T, pathOf func(T) string, beforeEach func() error, task func(T)) error {
+	var (
+		groups      = make(map[*ioDevice][]T)
+		order       = make([]*ioDevice, 0)
+		tasks       sync.WaitGroup
+		dispatchers sync.WaitGroup
+		errs        = make(chan error, len(items))
+	)
+	for _, item := range items {
+		device := fileIOScheduler.deviceOf(pathOf(item))
+		if _, ok := groups[device]; !ok {
+			order = append(order, device)
+		}
+		groups[device] = append(groups[device], item)
+	}
+	for _, device := range order {
+		dispatchers.Add(1)
+		go func(device *ioDevice, items []T) {
+			defer dispatchers.Done()
+			for _, item := range items {
+				if beforeEach != nil {
+					if err := beforeEach(); err != nil {
+						errs <- err
+						return
+					}
+				}
+				if err := device.acquire(ctx); err != nil {
+					errs <- err
+					return
+				}
+				tasks.Add(1)
+				go func(item T) {
+					defer tasks.Done()
+					defer device.release()
+					task(item)
+				}(item)
+			}
+		}(device, groups[device])
+	}
+	dispatchers.Wait()
+	tasks.Wait()
+	close(errs)
+	return <-errs
+}
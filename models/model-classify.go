@@ -0,0 +1,315 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/vixalie/sd-content-manager/utils"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// 推断结果中使用的模型类型和基础模型名称均与Civitai保持一致，以便与有Civitai信息的模型统一展示和筛选。
+const (
+	inferredCheckpoint       = "Checkpoint"
+	inferredLora             = "LORA"
+	inferredLoCon            = "LoCon"
+	inferredLoHa             = "LoHa"
+	inferredTextualInversion = "TextualInversion"
+	inferredVAE              = "VAE"
+	inferredControlnet       = "Controlnet"
+
+	inferredSD15  = "SD 1.5"
+	inferredSD21  = "SD 2.1"
+	inferredSDXL  = "SDXL 1.0"
+	inferredFluxD = "Flux.1 D"
+	inferredFluxS = "Flux.1 S"
+	inferredSDVAE = "SD 1.5" // SD1.x与SDXL的VAE结构完全相同，无法区分时使用的默认值。
+)
+
+type ModelClassification struct {
+	ModelType           *string `json:"modelType"`
+	ModelTypeConfidence string  `json:"modelTypeConfidence"`
+	BaseModel           *string `json:"baseModel"`
+	BaseModelConfidence string  `json:"baseModelConfidence"`
+}
+
+// 文本编码器交叉注意力的上下文维度与基础模型的对应关系。
+var contextDimBaseModels = map[int64]string{
+	768:  inferredSD15,
+	1024: inferredSD21,
+	2048: inferredSDXL,
+}
+
+func anyTensorKey(header *utils.SafetensorsHeader, predicate func(key string) bool) bool {
+	for key := range header.Tensors {
+		if predicate(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTensorPrefix(header *utils.SafetensorsHeader, prefixes ...string) bool {
+	return anyTensorKey(header, func(key string) bool {
+		return lo.SomeBy(prefixes, func(prefix string) bool { return strings.HasPrefix(key, prefix) })
+	})
+}
+
+func hasTensorPart(header *utils.SafetensorsHeader, parts ...string) bool {
+	return anyTensorKey(header, func(key string) bool {
+		return lo.SomeBy(parts, func(part string) bool { return strings.Contains(key, part) })
+	})
+}
+
+// 从训练工具写入的元数据中获取基础模型，这些信息是确定的。
+func baseModelFromMetadata(metadata map[string]string) *string {
+	var baseModel string
+	version := strings.ToLower(metadata["ss_base_model_version"])
+	architecture := strings.ToLower(metadata["modelspec.architecture"])
+	switch {
+	case strings.HasPrefix(version, "sdxl"), strings.HasPrefix(architecture, "stable-diffusion-xl"):
+		baseModel = inferredSDXL
+	case strings.HasPrefix(version, "sd_v2"), strings.HasPrefix(architecture, "stable-diffusion-v2"):
+		baseModel = inferredSD21
+	case strings.HasPrefix(version, "sd_v1"), strings.HasPrefix(architecture, "stable-diffusion-v1"):
+		baseModel = inferredSD15
+	case strings.Contains(architecture, "flux-1-schnell"):
+		baseModel = inferredFluxS
+	case strings.HasPrefix(version, "flux"), strings.HasPrefix(architecture, "flux"):
+		baseModel = inferredFluxD
+	default:
+		return nil
+	}
+	return &baseModel
+}
+
+// 根据交叉注意力层to_k权重的输入维度判断文本编码器的上下文维度，进而判断基础模型。
+// suffix用于选择完整权重或者LoRA的下投影权重，二者的第二个维度都是上下文维度。
+func baseModelFromContextDim(header *utils.SafetensorsHeader, suffixes ...string) *string {
+	for key, tensor := range header.Tensors {
+		if !strings.Contains(key, "attn2") || len(tensor.Shape) != 2 {
+			continue
+		}
+		if !lo.SomeBy(suffixes, func(suffix string) bool { return strings.HasSuffix(key, suffix) }) {
+			continue
+		}
+		if baseModel, ok := contextDimBaseModels[tensor.Shape[1]]; ok {
+			return &baseModel
+		}
+	}
+	return nil
+}
+
+// 根据Safetensors文件中张量的名称和形状推断模型类型和基础模型。
+func classifyTensorLayout(header *utils.SafetensorsHeader) ModelClassification {
+	var (
+		result           ModelClassification
+		modelType        string
+		typeConfidence   = entities.InferenceConfidenceHigh
+		baseModel        *string
+		baseConfidence   = entities.InferenceConfidenceHigh
+		metadataBase     = baseModelFromMetadata(header.Metadata)
+		isFluxLayout     = hasTensorPart(header, "double_blocks", "single_blocks", "single_transformer_blocks")
+		isFluxGuidanceIn = hasTensorPart(header, "guidance_in")
+	)
+	switch {
+	case hasTensorPart(header, ".hada_w1_a", ".hada_w1_b"):
+		modelType = inferredLoHa
+		baseModel = baseModelFromContextDim(header, "to_k.hada_w1_b")
+	case hasTensorPart(header, ".lokr_w1", ".lora_down.weight", ".lora_up.weight", ".lora_A.weight", ".lora.down.weight"):
+		modelType = inferredLora
+		// 包含卷积层的LoRA即为LoCon，卷积层的下投影权重是四维张量。
+		isLoCon := lo.SomeBy(lo.Entries(header.Tensors), func(entry lo.Entry[string, utils.SafetensorsTensor]) bool {
+			return strings.HasSuffix(entry.Key, ".lora_down.weight") && len(entry.Value.Shape) == 4 && entry.Value.Shape[2] > 1
+		})
+		if isLoCon || hasTensorPart(header, ".lokr_w1") || strings.Contains(header.Metadata["ss_network_module"], "lycoris") {
+			modelType = inferredLoCon
+		}
+		baseModel = baseModelFromContextDim(header, "to_k.lora_down.weight", "to_k.lora_A.weight", "to_k.lora.down.weight")
+		if baseModel == nil && hasTensorPrefix(header, "lora_te1_", "lora_te2_") {
+			// 包含两个文本编码器的LoRA只可能是SDXL的LoRA。
+			sdxl := inferredSDXL
+			baseModel = &sdxl
+		}
+		if baseModel == nil && isFluxLayout {
+			// LoRA中没有可以区分Flux.1 Dev与Schnell的张量，Dev是更常见的训练对象。
+			flux := inferredFluxD
+			baseModel = &flux
+			baseConfidence = entities.InferenceConfidenceLow
+		}
+	case hasTensorPrefix(header, "emb_params", "clip_l", "clip_g", "string_to_param"):
+		modelType = inferredTextualInversion
+		var dim int64
+		for key, tensor := range header.Tensors {
+			if len(tensor.Shape) == 0 {
+				continue
+			}
+			if key == "clip_g" {
+				dim = 1280
+				break
+			}
+			dim = tensor.Shape[len(tensor.Shape)-1]
+		}
+		switch dim {
+		case 768:
+			baseModel = lo.ToPtr(inferredSD15)
+		case 1024:
+			baseModel = lo.ToPtr(inferredSD21)
+		case 1280:
+			baseModel = lo.ToPtr(inferredSDXL)
+		}
+	case hasTensorPrefix(header, "control_model.", "controlnet_", "input_hint_block.") || hasTensorPart(header, "controlnet_cond_embedding", "zero_convs"):
+		modelType = inferredControlnet
+		baseModel = baseModelFromContextDim(header, "to_k.weight")
+		if baseModel == nil && isFluxLayout {
+			baseModel = lo.ToPtr(inferredFluxD)
+			baseConfidence = entities.InferenceConfidenceLow
+		}
+	case hasTensorPrefix(header, "model.diffusion_model.", "double_blocks.", "single_blocks.", "conditioner.embedders."):
+		modelType = inferredCheckpoint
+		switch {
+		case isFluxLayout && isFluxGuidanceIn:
+			baseModel = lo.ToPtr(inferredFluxD)
+		case isFluxLayout:
+			baseModel = lo.ToPtr(inferredFluxS)
+		default:
+			baseModel = baseModelFromContextDim(header, "to_k.weight")
+		}
+	case hasTensorPrefix(header, "encoder.", "decoder.", "first_stage_model.") && hasTensorPart(header, "decoder.conv_in.weight"):
+		modelType = inferredVAE
+		baseConfidence = entities.InferenceConfidenceLow
+		for key, tensor := range header.Tensors {
+			if !strings.HasSuffix(key, "decoder.conv_in.weight") || len(tensor.Shape) != 4 {
+				continue
+			}
+			// Flux的VAE使用16通道的潜空间，SD系列的VAE使用4通道的潜空间。
+			if tensor.Shape[1] == 16 {
+				baseModel = lo.ToPtr(inferredFluxD)
+			} else {
+				baseModel = lo.ToPtr(inferredSDVAE)
+			}
+		}
+	default:
+		// 无法识别的张量布局，仍然可以根据元数据确定基础模型。
+		if metadataBase != nil {
+			result.BaseModel = metadataBase
+			result.BaseModelConfidence = entities.InferenceConfidenceHigh
+		}
+		return result
+	}
+	if metadataBase != nil {
+		baseModel = metadataBase
+		baseConfidence = entities.InferenceConfidenceHigh
+	}
+	if baseModel == nil {
+		// 只识别出部分张量布局的文件，其模型类型的判断也不完全可靠。
+		typeConfidence = entities.InferenceConfidenceLow
+	}
+	result.ModelType = &modelType
+	result.ModelTypeConfidence = typeConfidence
+	if baseModel != nil {
+		result.BaseModel = baseModel
+		result.BaseModelConfidence = baseConfidence
+	}
+	return result
+}
+
+// 读取模型文件并推断其模型类型和基础模型，只支持Safetensors文件。
+func classifyModelFile(filePath string) (*ModelClassification, error) {
+	if format, _ := utils.DetectModelFormat(filePath); format != utils.FormatSafetensors {
+		return nil, nil
+	}
+	header, err := utils.ReadSafetensorsHeader(filePath)
+	if err != nil {
+		return nil, err
+	}
+	result := classifyTensorLayout(header)
+	return &result, nil
+}
+
+// 将推断结果填入文件记录。用户手动记录过的内容（可信程度为空但内容不为空）不会被覆盖，除非指定了force。
+func applyClassification(file *entities.FileCache, classification *ModelClassification, force bool) {
+	if classification == nil {
+		return
+	}
+	if classification.ModelType != nil && (force || file.ModelType == nil || file.ModelTypeConfidence != nil) {
+		file.ModelType = classification.ModelType
+		file.ModelTypeConfidence = lo.ToPtr(classification.ModelTypeConfidence)
+	}
+	if classification.BaseModel != nil && (force || file.BaseModel == nil || file.BaseModelConfidence != nil) {
+		file.BaseModel = classification.BaseModel
+		file.BaseModelConfidence = lo.ToPtr(classification.BaseModelConfidence)
+	}
+}
+
+// 判断已经记录的文件是否需要补充推断，在推断功能出现之前记录的、没有对应Civitai模型信息的Safetensors文件需要补充推断。
+// 已经推断过的文件即使没能推断出基础模型，在文件发生变化之前也不会再次推断。
+func needsClassification(file *entities.FileCache) bool {
+	unidentified := file.RelatedModelVersionId == nil || *file.RelatedModelVersionId == 0
+	return unidentified && file.BaseModel == nil && file.Format == utils.FormatSafetensors && file.ClassifiedModTime != file.FileModTime
+}
+
+// 为已经记录的文件补充推断模型类型和基础模型，并更新检索索引。
+func backfillClassification(ctx context.Context, file *entities.FileCache) {
+	if !needsClassification(file) {
+		return
+	}
+	if err := inferUnidentifiedFile(ctx, file); err != nil {
+		runtime.LogErrorf(ctx, "推断文件 [%s] 模型类型失败，%s", file.FullPath, err)
+		return
+	}
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	logReindexError(ctx, reindexFileCaches(dbConn, file.Id))
+}
+
+// 对没有对应Civitai模型信息的文件推断模型类型和基础模型，并保存推断结果。
+func inferUnidentifiedFile(ctx context.Context, file *entities.FileCache) error {
+	if file.RelatedModelVersionId != nil && *file.RelatedModelVersionId != 0 {
+		return nil
+	}
+	classification, err := classifyModelFile(file.FullPath)
+	if err != nil {
+		return fmt.Errorf("未能推断模型文件类型，%w", err)
+	}
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	applyClassification(file, classification, false)
+	file.ClassifiedModTime = file.FileModTime
+	result := dbConn.Model(&entities.FileCache{}).Where("id = ?", file.Id).Updates(map[string]any{
+		"model_type":            file.ModelType,
+		"model_type_confidence": file.ModelTypeConfidence,
+		"base_model":            file.BaseModel,
+		"base_model_confidence": file.BaseModelConfidence,
+		"classified_mod_time":   file.ClassifiedModTime,
+	})
+	return result.Error
+}
+
+// 重新推断指定文件的模型类型和基础模型，会覆盖用户手动记录的内容。
+func reclassifyModelFile(ctx context.Context, fileId string) (*entities.FileCache, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var file entities.FileCache
+	result := dbConn.Where("id = ?", fileId).First(&file)
+	if result.Error != nil {
+		return nil, fmt.Errorf("未找到指定的文件记录，%w", result.Error)
+	}
+	classification, err := classifyModelFile(file.FullPath)
+	if err != nil {
+		return nil, fmt.Errorf("未能推断模型文件类型，%w", err)
+	}
+	if classification == nil {
+		return nil, fmt.Errorf("只能推断Safetensors格式的模型文件")
+	}
+	applyClassification(&file, classification, true)
+	file.ClassifiedModTime = file.FileModTime
+	result = dbConn.Save(&file)
+	if result.Error != nil {
+		return nil, fmt.Errorf("保存推断结果失败，%w", result.Error)
+	}
+	logReindexError(ctx, reindexFileCaches(dbConn, file.Id))
+	return &file, nil
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// Civitai中表示不允许任何商业用途的取值。
+const commercialUseNone = "None"
+
+// 需要提示许可限制的操作。
+const (
+	LicenseActionDownload   = "download"
+	LicenseActionCopyPrompt = "copy-prompt"
+)
+
+var commercialUseLabels = map[string]string{
+	"Image":     "出售生成的图片",
+	"RentCivit": "在Civitai的生成服务中使用",
+	"Rent":      "在其他生成服务中使用",
+	"Sell":      "出售模型或者融合模型",
+}
+
+// 模型的许可权限，未缓存许可权限的模型各项均为空。
+type ModelLicense struct {
+	ModelId               int      `json:"modelId"`
+	AllowNoCredit         *bool    `json:"allowNoCredit"`
+	AllowCommercialUse    []string `json:"allowCommercialUse"`
+	AllowDerivatives      *bool    `json:"allowDerivatives"`
+	AllowDifferentLicense *bool    `json:"allowDifferentLicense"`
+	CommercialUse         *bool    `json:"commercialUse"` // 是否允许任何一种商业用途，许可权限未知时为空。
+	Restrictions          []string `json:"restrictions"`
+}
+
+type LicenseWarningEventPayload struct {
+	ModelId      int      `json:"modelId"`
+	ModelName    string   `json:"modelName"`
+	Action       string   `json:"action"`
+	Restrictions []string `json:"restrictions"`
+}
+
+// 判断模型是否允许任何一种商业用途，尚未缓存许可权限的模型返回空。
+func commercialUseAllowed(model *entities.Model) *bool {
+	if model == nil || model.AllowCommercialUse == nil {
+		return nil
+	}
+	return lo.ToPtr(lo.SomeBy(model.AllowCommercialUse, func(permission string) bool {
+		return permission != commercialUseNone
+	}))
+}
+
+// 列出模型许可中的各项限制，用于向用户展示。
+func describeLicenseRestrictions(model *entities.Model) []string {
+	restrictions := make([]string, 0)
+	if allowed := commercialUseAllowed(model); allowed != nil {
+		if !*allowed {
+			restrictions = append(restrictions, "不允许任何商业用途")
+		} else {
+			for _, permission := range []string{"Image", "RentCivit", "Rent", "Sell"} {
+				if !lo.Contains(model.AllowCommercialUse, permission) {
+					restrictions = append(restrictions, "不允许"+commercialUseLabels[permission])
+				}
+			}
+		}
+	}
+	if model.AllowNoCredit != nil && !*model.AllowNoCredit {
+		restrictions = append(restrictions, "使用时需要注明模型作者")
+	}
+	if model.AllowDerivatives != nil && !*model.AllowDerivatives {
+		restrictions = append(restrictions, "不允许分享融合模型")
+	}
+	if model.AllowDifferentLicense != nil && !*model.AllowDifferentLicense {
+		restrictions = append(restrictions, "融合模型不允许使用不同的许可权限")
+	}
+	return restrictions
+}
+
+func describeModelLicense(model *entities.Model) *ModelLicense {
+	return &ModelLicense{
+		ModelId:               model.Id,
+		AllowNoCredit:         model.AllowNoCredit,
+		AllowCommercialUse:    model.AllowCommercialUse,
+		AllowDerivatives:      model.AllowDerivatives,
+		AllowDifferentLicense: model.AllowDifferentLicense,
+		CommercialUse:         commercialUseAllowed(model),
+		Restrictions:          describeLicenseRestrictions(model),
+	}
+}
+
+func fetchModelLicense(ctx context.Context, modelId int) (*ModelLicense, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var model entities.Model
+	if result := dbConn.Where("id = ?", modelId).First(&model); result.Error != nil {
+		return nil, fmt.Errorf("未找到指定的模型信息，%w", result.Error)
+	}
+	return describeModelLicense(&model), nil
+}
+
+// 在下载模型或者复制提示词之前检查模型的许可权限，模型不允许商业用途时向前端发出警告。操作本身不会被阻止。
+// 提供给`Remote`包使用。
+func WarnLicenseRestrictions(ctx context.Context, model *entities.Model, action string) {
+	if allowed := commercialUseAllowed(model); allowed == nil || *allowed {
+		return
+	}
+	runtime.LogWarningf(ctx, "模型 [%s] 不允许商业用途", model.Name)
+	runtime.EventsEmit(ctx, "license-warning", LicenseWarningEventPayload{
+		ModelId:      model.Id,
+		ModelName:    model.Name,
+		Action:       action,
+		Restrictions: describeLicenseRestrictions(model),
+	})
+}
+
+// 从已经缓存的Civitai原始响应中补充许可权限出现之前缓存的模型的许可权限。
+func backfillModelLicenses(ctx context.Context) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var cachedModels []entities.Model
+	result := dbConn.Where("allow_commercial_use IS NULL AND civitai_original_response IS NOT NULL").Find(&cachedModels)
+	if result.Error != nil {
+		runtime.LogErrorf(ctx, "查询缺少许可权限的模型失败，%s", result.Error)
+		return
+	}
+	for _, model := range cachedModels {
+		var modelInfo Model
+		if err := json.Unmarshal(model.CivitaiOriginalResponse, &modelInfo); err != nil || modelInfo.AllowCommercialUse == nil {
+			continue
+		}
+		model.AllowNoCredit = modelInfo.AllowNoCredit
+		model.AllowCommercialUse = modelInfo.AllowCommercialUse
+		model.AllowDerivatives = modelInfo.AllowDerivatives
+		model.AllowDifferentLicense = modelInfo.AllowDifferentLicense
+		result := dbConn.Model(&model).
+			Select("allow_no_credit", "allow_commercial_use", "allow_derivatives", "allow_different_license").
+			Updates(&model)
+		if result.Error != nil {
+			runtime.LogErrorf(ctx, "补充模型 [%d] 许可权限失败，%s", model.Id, result.Error)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"gorm.io/gorm"
+)
+
+// 新版本与本地已有版本的基础模型的兼容情况。
+const (
+	BaseModelSame      = "same"      // 与某一本地版本的基础模型相同。
+	BaseModelFamily    = "family"    // 基础模型不同，但属于同一结构，例如SDXL 1.0与Pony。
+	BaseModelDifferent = "different" // 基础模型与全部本地版本都不兼容。
+	BaseModelUnknown   = "unknown"   // 新版本或者本地版本没有记录基础模型。
+)
+
+type AvailableVersionUpdate struct {
+	VersionId        int        `json:"versionId"`
+	VersionName      string     `json:"versionName"`
+	BaseModel        *string    `json:"baseModel"`
+	CivitaiCreatedAt *time.Time `json:"civitaiCreatedAt"`
+	Compatibility    string     `json:"compatibility"`
+}
+
+type ModelUpdates struct {
+	ModelId                int                      `json:"modelId"`
+	ModelName              string                   `json:"modelName"`
+	ModelType              string                   `json:"modelType"`
+	LatestLocalVersionId   int                      `json:"latestLocalVersionId"`
+	LatestLocalVersionName string                   `json:"latestLocalVersionName"`
+	LocalBaseModels        []string                 `json:"localBaseModels"`
+	Updates                []AvailableVersionUpdate `json:"updates"` // 按照发布时间从新到旧排列。
+}
+
+// 判断新版本的基础模型与本地版本的基础模型是否兼容。
+func baseModelCompatibility(baseModel *string, localBaseModels []string) string {
+	if baseModel == nil || len(localBaseModels) == 0 {
+		return BaseModelUnknown
+	}
+	if lo.SomeBy(localBaseModels, func(local string) bool { return strings.EqualFold(local, *baseModel) }) {
+		return BaseModelSame
+	}
+	family := webuiSDVersion(baseModel)
+	if family != webuiSDVersionUnknown && lo.SomeBy(localBaseModels, func(local string) bool { return webuiSDVersion(&local) == family }) {
+		return BaseModelFamily
+	}
+	return BaseModelDifferent
+}
+
+// 列出至少存在一个本地版本的模型中，比最新的本地版本发布得更晚并且尚未下载的版本。
+// 模型版本信息来自批量更新模型信息时缓存的内容，已经从Civitai删除的模型不会列出。
+func listModelUpdates(ctx context.Context) ([]ModelUpdates, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var localVersionIds []int
+	result := dbConn.Model(&entities.FileCache{}).
+		Where("related_model_version_id IS NOT NULL").
+		Distinct().
+		Pluck("related_model_version_id", &localVersionIds)
+	if result.Error != nil {
+		return nil, fmt.Errorf("查询本地已有的模型版本失败，%w", result.Error)
+	}
+	var modelIds []int
+	result = dbConn.Model(&entities.ModelVersion{}).
+		Where("id IN ? AND model_id IS NOT NULL", localVersionIds).
+		Distinct().
+		Pluck("model_id", &modelIds)
+	if result.Error != nil {
+		return nil, fmt.Errorf("查询本地已有版本对应的模型失败，%w", result.Error)
+	}
+	var cachedModels []entities.Model
+	result = dbConn.Preload("Versions").Where("id IN ? AND civitail_deleted = ?", modelIds, false).Find(&cachedModels)
+	if result.Error != nil {
+		return nil, fmt.Errorf("查询模型版本信息失败，%w", result.Error)
+	}
+	localVersions := lo.SliceToMap(localVersionIds, func(id int) (int, bool) { return id, true })
+	modelUpdates := make([]ModelUpdates, 0)
+	for _, model := range cachedModels {
+		local := lo.Filter(model.Versions, func(version entities.ModelVersion, _ int) bool {
+			return localVersions[version.Id]
+		})
+		remote := lo.Filter(model.Versions, func(version entities.ModelVersion, _ int) bool {
+			return !localVersions[version.Id]
+		})
+		datedLocal := lo.Filter(local, func(version entities.ModelVersion, _ int) bool {
+			return version.CivitaiCreatedAt != nil
+		})
+		if len(datedLocal) == 0 {
+			continue
+		}
+		latestLocal := lo.MaxBy(datedLocal, func(a, b entities.ModelVersion) bool {
+			return a.CivitaiCreatedAt.After(*b.CivitaiCreatedAt)
+		})
+		localBaseModels := lo.Uniq(lo.FilterMap(local, func(version entities.ModelVersion, _ int) (string, bool) {
+			return lo.FromPtrOr(version.BaseModel, ""), version.BaseModel != nil
+		}))
+		updates := make([]AvailableVersionUpdate, 0)
+		for _, version := range remote {
+			if version.CivitaiCreatedAt == nil || !version.CivitaiCreatedAt.After(*latestLocal.CivitaiCreatedAt) {
+				continue
+			}
+			updates = append(updates, AvailableVersionUpdate{
+				VersionId:        version.Id,
+				VersionName:      version.VersionName,
+				BaseModel:        version.BaseModel,
+				CivitaiCreatedAt: version.CivitaiCreatedAt,
+				Compatibility:    baseModelCompatibility(version.BaseModel, localBaseModels),
+			})
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		sort.Slice(updates, func(i, j int) bool {
+			return updates[i].CivitaiCreatedAt.After(*updates[j].CivitaiCreatedAt)
+		})
+		modelUpdates = append(modelUpdates, ModelUpdates{
+			ModelId:                model.Id,
+			ModelName:              model.Name,
+			ModelType:              model.Type,
+			LatestLocalVersionId:   latestLocal.Id,
+			LatestLocalVersionName: latestLocal.VersionName,
+			LocalBaseModels:        localBaseModels,
+			Updates:                updates,
+		})
+	}
+	sort.Slice(modelUpdates, func(i, j int) bool {
+		return modelUpdates[i].Updates[0].CivitaiCreatedAt.After(*modelUpdates[j].Updates[0].CivitaiCreatedAt)
+	})
+	return modelUpdates, nil
+}
+
+// 提供`Remote`包使用的接口。
+func ListModelUpdates(ctx context.Context) ([]ModelUpdates, error) {
+	return listModelUpdates(ctx)
+}
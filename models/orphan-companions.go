@@ -0,0 +1,183 @@
+package models
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/config"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// 找不到对应模型文件的陪同文件，通常是手动删除模型文件之后遗留下来的。
+type OrphanCompanion struct {
+	Path string `json:"path"`
+	Role string `json:"role"`
+	Size int64  `json:"size"`
+	// 只有带有专用后缀的文件（例如name.preview.png、name.civitai.info）才能确定是陪同文件，
+	// 仅有普通扩展名的文件（例如name.png、name.json）也可能是用户自行放置在模型目录中的其他文件。
+	Certain bool `json:"certain"`
+}
+
+type OrphanCompanionGroup struct {
+	Dir       string            `json:"dir"`
+	Files     []OrphanCompanion `json:"files"`
+	TotalSize int64             `json:"totalSize"`
+}
+
+type OrphanCompanionReport struct {
+	Groups     []OrphanCompanionGroup `json:"groups"`
+	TotalFiles int                    `json:"totalFiles"`
+	TotalSize  int64                  `json:"totalSize"`
+}
+
+type OrphanCleanupFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type OrphanCleanupResult struct {
+	DryRun bool                   `json:"dryRun"`
+	Report *OrphanCompanionReport `json:"report"` // 已经删除的文件，试运行时为将要删除的文件。
+	Failed []OrphanCleanupFailure `json:"failed"`
+}
+
+// 判断文件名称是否符合某一陪同文件命名约定，返回全部可能的模型文件名称（小写，不含扩展名）以及对应的约定。
+// 一个文件可能同时符合多个约定，例如name.preview.png既可以是name的预览图，也可以是name.preview的预览图。
+func companionCandidates(fileName string) ([]string, []companionConvention) {
+	lowerName := strings.ToLower(fileName)
+	bases := make([]string, 0)
+	conventions := make([]companionConvention, 0)
+	for _, convention := range companionConventions {
+		if strings.HasSuffix(lowerName, convention.Suffix) && len(lowerName) > len(convention.Suffix) {
+			bases = append(bases, strings.TrimSuffix(lowerName, convention.Suffix))
+			conventions = append(conventions, convention)
+		}
+	}
+	return bases, conventions
+}
+
+// 检查一个目录中的孤立陪同文件，不包含子目录。
+func findOrphanCompanionsInDir(dir string) ([]OrphanCompanion, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	modelBases := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		if config.IsModelExtension("", ext) {
+			modelBases[strings.ToLower(strings.TrimSuffix(entry.Name(), ext))] = true
+		}
+	}
+	orphans := make([]OrphanCompanion, 0)
+	for _, entry := range entries {
+		// 与模型同名的VAE等文件本身也是模型文件，不作为陪同文件处理。
+		if entry.IsDir() || config.IsModelExtension("", filepath.Ext(entry.Name())) {
+			continue
+		}
+		bases, conventions := companionCandidates(entry.Name())
+		if len(bases) == 0 || lo.SomeBy(bases, func(base string) bool { return modelBases[base] }) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		// 优先使用后缀最长的约定确定文件用途。
+		convention := lo.MaxBy(conventions, func(a, b companionConvention) bool {
+			return len(a.Suffix) > len(b.Suffix)
+		})
+		orphans = append(orphans, OrphanCompanion{
+			Path:    filepath.Join(dir, entry.Name()),
+			Role:    convention.Role,
+			Size:    info.Size(),
+			Certain: strings.Count(convention.Suffix, ".") > 1,
+		})
+	}
+	return orphans, nil
+}
+
+// 在全部已配置的模型目录及其子目录中查找孤立的陪同文件，结果按照所在目录分组。
+func scanOrphanCompanions(ctx context.Context) *OrphanCompanionReport {
+	var (
+		report = &OrphanCompanionReport{Groups: make([]OrphanCompanionGroup, 0)}
+		// 不同模型类型的目录之间可能存在嵌套，每个目录只检查一次。
+		visited = make(map[string]bool)
+	)
+	for _, managedDir := range listManagedModelDirs(ctx) {
+		filepath.WalkDir(managedDir.Path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if visited[path] {
+				return filepath.SkipDir
+			}
+			visited[path] = true
+			orphans, err := findOrphanCompanionsInDir(path)
+			if err != nil {
+				runtime.LogWarningf(ctx, "检查目录 [%s] 中的孤立陪同文件失败，%s", path, err)
+				return nil
+			}
+			if len(orphans) > 0 {
+				group := OrphanCompanionGroup{Dir: path, Files: orphans}
+				group.TotalSize = lo.SumBy(orphans, func(orphan OrphanCompanion) int64 { return orphan.Size })
+				report.Groups = append(report.Groups, group)
+			}
+			return nil
+		})
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		return report.Groups[i].Dir < report.Groups[j].Dir
+	})
+	report.refreshTotals()
+	return report
+}
+
+func (r *OrphanCompanionReport) refreshTotals() {
+	r.TotalFiles = lo.SumBy(r.Groups, func(group OrphanCompanionGroup) int { return len(group.Files) })
+	r.TotalSize = lo.SumBy(r.Groups, func(group OrphanCompanionGroup) int64 { return group.TotalSize })
+}
+
+// 清理孤立的陪同文件。清理时会重新检查全部目录，以免删除检查之后重新出现了对应模型文件的陪同文件。
+// 默认只清理能够确定是陪同文件的文件，dryRun为true时只返回将要删除的文件而不实际删除。
+func cleanupOrphanCompanions(ctx context.Context, dryRun, includeUncertain bool) *OrphanCleanupResult {
+	scanned := scanOrphanCompanions(ctx)
+	result := &OrphanCleanupResult{
+		DryRun: dryRun,
+		Report: &OrphanCompanionReport{Groups: make([]OrphanCompanionGroup, 0)},
+		Failed: make([]OrphanCleanupFailure, 0),
+	}
+	for _, group := range scanned.Groups {
+		targets := lo.Filter(group.Files, func(orphan OrphanCompanion, _ int) bool {
+			return orphan.Certain || includeUncertain
+		})
+		if !dryRun {
+			targets = lo.Filter(targets, func(orphan OrphanCompanion, _ int) bool {
+				if err := os.Remove(orphan.Path); err != nil {
+					result.Failed = append(result.Failed, OrphanCleanupFailure{Path: orphan.Path, Error: err.Error()})
+					return false
+				}
+				runtime.LogInfof(ctx, "已删除孤立陪同文件 [%s]", orphan.Path)
+				return true
+			})
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		result.Report.Groups = append(result.Report.Groups, OrphanCompanionGroup{
+			Dir:       group.Dir,
+			Files:     targets,
+			TotalSize: lo.SumBy(targets, func(orphan OrphanCompanion) int64 { return orphan.Size }),
+		})
+	}
+	result.Report.refreshTotals()
+	return result
+}
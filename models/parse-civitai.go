@@ -105,11 +105,15 @@ func persistModelVersion(ctx context.Context, versionInfo *ModelVersion, origina
 		CivitaiOriginalResponse: original,
 		CivitaiCreatedAt:        versionInfo.CreatedAt,
 		CivitaiUpdatedAt:        versionInfo.UpdatedAt,
+		Rating:                  versionInfo.Stats.Rating.InexactFloat64(),
+		RatingCount:             versionInfo.Stats.RatingCount,
+		DownloadCount:           versionInfo.Stats.DownloadCount,
 	}
 	dbConn.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "id"}},
 		DoNothing: true,
 	}).Create(&modelVersion)
+	logReindexError(ctx, reindexVersionFiles(dbConn, modelVersion.Id))
 	return nil
 }
 
@@ -254,14 +258,20 @@ func persistModel(ctx context.Context, modelInfo *Model, original []byte) error
 		Mode:                    modelInfo.Mode,
 		CivitaiOriginalResponse: original,
 		LastSyncedAt:            lo.ToPtr(time.Now()),
+		AllowNoCredit:           modelInfo.AllowNoCredit,
+		AllowCommercialUse:      modelInfo.AllowCommercialUse,
+		AllowDerivatives:        modelInfo.AllowDerivatives,
+		AllowDifferentLicense:   modelInfo.AllowDifferentLicense,
 	}
 	result = dbConn.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "nsfw", "person_of_interest", "author", "type", "mode", "civitai_original_response", "last_synced_at"}),
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "nsfw", "person_of_interest", "author", "type", "mode", "civitai_original_response", "last_synced_at",
+			"allow_no_credit", "allow_commercial_use", "allow_derivatives", "allow_different_license"}),
 	}).Create(&model)
 	if result.Error != nil {
 		return result.Error
 	}
+	logReindexError(ctx, reindexModelFiles(dbConn, model.Id))
 	return nil
 }
 
@@ -284,6 +294,7 @@ func persistModelTags(ctx context.Context, modelId int, tags []string) error {
 			return fmt.Errorf("无法保存模型标签，%w", result.Error)
 		}
 	}
+	logReindexError(ctx, reindexModelFiles(dbConn, modelId))
 	return nil
 }
 
@@ -354,14 +365,18 @@ func refreshModelVersion(ctx context.Context, modelVersion *ModelVersion) error
 		CivitaiCreatedAt:        modelVersion.CreatedAt,
 		CivitaiUpdatedAt:        modelVersion.UpdatedAt,
 		LastSyncedAt:            lo.ToPtr(time.Now()),
+		Rating:                  modelVersion.Stats.Rating.InexactFloat64(),
+		RatingCount:             modelVersion.Stats.RatingCount,
+		DownloadCount:           modelVersion.Stats.DownloadCount,
 	}
 	result = dbConn.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"model_id", "version_name", "activate_prompt", "base_model", "page_url", "download_url", "primary_file_id", "cover_used", "civitai_original_response", "civitai_created_at", "civitai_updated_at", "last_synced_at"}),
+		DoUpdates: clause.AssignmentColumns([]string{"model_id", "version_name", "activate_prompt", "base_model", "page_url", "download_url", "primary_file_id", "cover_used", "civitai_original_response", "civitai_created_at", "civitai_updated_at", "last_synced_at", "rating", "rating_count", "download_count"}),
 	}).Create(newModelVersion)
 	if result.Error != nil {
 		return fmt.Errorf("无法保存模型版本信息，%w", result.Error)
 	}
+	logReindexError(ctx, reindexVersionFiles(dbConn, newModelVersion.Id))
 	return nil
 }
 
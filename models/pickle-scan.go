@@ -0,0 +1,63 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/vixalie/sd-content-manager/utils"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+type PickleWarningEventPayload struct {
+	Id       string   `json:"id"`
+	File     string   `json:"file"`
+	Verdict  string   `json:"verdict"`
+	Findings []string `json:"findings"`
+}
+
+// 判断文件是否需要进行pickle安全检查，只有PyTorch格式并且尚未检查过的文件才需要检查。
+func needsPickleScan(file *entities.FileCache) bool {
+	return file.PickleVerdict == nil && (file.Format == utils.FormatTorchZip || file.Format == utils.FormatPickle)
+}
+
+// 对文件进行pickle安全检查并保存结论，发现危险或者可疑的对象时向前端发送警告。不是PyTorch格式的文件会清除已有的结论。
+func recordPickleScan(ctx context.Context, file *entities.FileCache) (*utils.PickleScanResult, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	scanResult, err := utils.ScanPickleFile(file.FullPath)
+	if err != nil {
+		return nil, fmt.Errorf("未能检查模型文件的pickle数据，%w", err)
+	}
+	file.PickleVerdict = nil
+	file.PickleFindings = nil
+	if scanResult != nil {
+		file.PickleVerdict = &scanResult.Verdict
+		file.PickleFindings = append(scanResult.Dangerous, scanResult.Suspicious...)
+	}
+	result := dbConn.Model(file).Select("pickle_verdict", "pickle_findings").Updates(file)
+	if result.Error != nil {
+		return nil, fmt.Errorf("保存pickle安全检查结论失败，%w", result.Error)
+	}
+	if scanResult != nil && scanResult.Verdict != utils.PickleSafe {
+		runtime.LogWarningf(ctx, "模型文件 [%s] 的pickle安全检查结论为 %s，引用了 %v", file.FullPath, scanResult.Verdict, file.PickleFindings)
+		runtime.EventsEmit(ctx, "pickle-warning", PickleWarningEventPayload{
+			Id:       file.Id,
+			File:     file.FullPath,
+			Verdict:  scanResult.Verdict,
+			Findings: file.PickleFindings,
+		})
+	}
+	return scanResult, nil
+}
+
+// 重新检查指定文件的pickle数据，返回完整的检查结果。不是PyTorch格式的文件返回nil。
+func rescanFilePickle(ctx context.Context, fileId string) (*utils.PickleScanResult, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var file entities.FileCache
+	if result := dbConn.Where("id = ?", fileId).First(&file); result.Error != nil {
+		return nil, fmt.Errorf("未找到指定的文件记录，%w", result.Error)
+	}
+	return recordPickleScan(ctx, &file)
+}
@@ -0,0 +1,274 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"archgrid.xyz/ag/toolsbox/serial_code/hail"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+type ScanJobState string
+
+const (
+	ScanJobRunning  ScanJobState = "running"
+	ScanJobPaused   ScanJobState = "paused"
+	ScanJobCanceled ScanJobState = "canceled"
+	ScanJobFinished ScanJobState = "finished"
+	ScanJobFailed   ScanJobState = "failed"
+)
+
+const (
+	ScanJobFullScan      = "full-scan"
+	ScanJobDuplicateScan = "duplicate-scan"
+	ScanJobHashBackfill  = "hash-backfill"
+)
+
+// 扫描任务的进度事件最短发送间隔，避免大量小文件扫描时事件过于频繁。
+const scanJobProgressInterval = 500 * time.Millisecond
+
+var ErrScanJobCanceled = errors.New("扫描任务已被取消")
+
+// 一个可以被暂停和取消的扫描任务。扫描任务中的文件处理协程需要在处理每个文件之前调用`waitIfPaused`。
+type ScanJob struct {
+	Id             string
+	Kind           string
+	ctx            context.Context
+	cancel         context.CancelFunc
+	lock           sync.Mutex
+	state          ScanJobState
+	resumeSignal   chan struct{}
+	startedAt      time.Time
+	pausedAt       time.Time
+	pausedDuration time.Duration
+	lastEmittedAt  time.Time
+	totalFiles     int64
+	processedFiles int64
+	totalBytes     int64
+	processedBytes int64
+	planRecorder   *scanPlanRecorder
+}
+
+type ScanJobProgress struct {
+	Id             string             `json:"id"`
+	Kind           string             `json:"kind"`
+	State          ScanJobState       `json:"state"`
+	TotalFiles     int64              `json:"totalFiles"`
+	ProcessedFiles int64              `json:"processedFiles"`
+	TotalBytes     int64              `json:"totalBytes"`
+	ProcessedBytes int64              `json:"processedBytes"`
+	Throughput     float64            `json:"throughput"` // 每秒处理的字节数，暂停的时间不计算在内。
+	Elapsed        int64              `json:"elapsed"`    // 扫描任务已经运行的秒数，暂停的时间不计算在内。
+	ETA            int64              `json:"eta"`        // 预计剩余秒数，无法估计时为-1。
+	Devices        []DeviceThroughput `json:"devices"`    // 各个存储设备的读取状况。
+}
+
+var (
+	scanJobs     = make(map[string]*ScanJob, 0)
+	scanJobsLock sync.Mutex
+)
+
+// 创建并登记一个新的扫描任务，同一类型的扫描任务同时只能运行一个。已经结束的任务记录会在登记新任务时被清理。
+func registerScanJob(ctx context.Context, kind string) (*ScanJob, error) {
+	scanJobsLock.Lock()
+	defer scanJobsLock.Unlock()
+	for id, job := range scanJobs {
+		if job.isActive() {
+			if job.Kind == kind {
+				return nil, fmt.Errorf("已经存在正在进行的扫描任务 %s", job.Id)
+			}
+			continue
+		}
+		delete(scanJobs, id)
+	}
+	hailEngine := ctx.Value("hail").(*hail.HailAlgorithm)
+	jobCtx, cancel := context.WithCancel(ctx)
+	job := &ScanJob{
+		Id:        hailEngine.GeneratePrefixedString("SJ"),
+		Kind:      kind,
+		ctx:       jobCtx,
+		cancel:    cancel,
+		state:     ScanJobRunning,
+		startedAt: time.Now(),
+	}
+	scanJobs[job.Id] = job
+	return job, nil
+}
+
+func findScanJob(jobId string) (*ScanJob, error) {
+	scanJobsLock.Lock()
+	defer scanJobsLock.Unlock()
+	job, ok := scanJobs[jobId]
+	if !ok {
+		return nil, fmt.Errorf("未找到指定的扫描任务 %s", jobId)
+	}
+	return job, nil
+}
+
+func listScanJobs() []ScanJobProgress {
+	scanJobsLock.Lock()
+	defer scanJobsLock.Unlock()
+	progresses := make([]ScanJobProgress, 0, len(scanJobs))
+	for _, job := range scanJobs {
+		progresses = append(progresses, job.Progress())
+	}
+	return progresses
+}
+
+func (j *ScanJob) isActive() bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.state == ScanJobRunning || j.state == ScanJobPaused
+}
+
+// 设置扫描任务需要处理的文件总量。
+func (j *ScanJob) setTotal(files, bytes int64) {
+	atomic.StoreInt64(&j.totalFiles, files)
+	atomic.StoreInt64(&j.totalBytes, bytes)
+	j.emitProgress(true)
+}
+
+// 为扫描任务关联扫描计划，此后处理完成的文件都会记录到扫描计划中。
+func (j *ScanJob) attachPlan(recorder *scanPlanRecorder) {
+	j.planRecorder = recorder
+}
+
+// 恢复扫描计划中已经完成的进度。
+func (j *ScanJob) restoreProgress(files, bytes int64) {
+	atomic.StoreInt64(&j.processedFiles, files)
+	atomic.StoreInt64(&j.processedBytes, bytes)
+	j.emitProgress(true)
+}
+
+// 记录一个文件已经处理完成。
+func (j *ScanJob) advance(target scanTarget) {
+	atomic.AddInt64(&j.processedFiles, 1)
+	atomic.AddInt64(&j.processedBytes, target.Size)
+	if j.planRecorder != nil && target.PlanItemId != 0 {
+		j.planRecorder.markDone(target.PlanItemId)
+	}
+	j.emitProgress(false)
+}
+
+// 在扫描任务被暂停时阻塞，直到任务被恢复或者被取消。任务被取消时返回错误。
+func (j *ScanJob) waitIfPaused() error {
+	j.lock.Lock()
+	signal := j.resumeSignal
+	j.lock.Unlock()
+	if signal != nil {
+		select {
+		case <-signal:
+		case <-j.ctx.Done():
+		}
+	}
+	if j.ctx.Err() != nil {
+		return ErrScanJobCanceled
+	}
+	return nil
+}
+
+func (j *ScanJob) Pause() error {
+	j.lock.Lock()
+	if j.state != ScanJobRunning {
+		j.lock.Unlock()
+		return fmt.Errorf("扫描任务当前状态为 %s，无法暂停", j.state)
+	}
+	j.state = ScanJobPaused
+	j.pausedAt = time.Now()
+	j.resumeSignal = make(chan struct{})
+	j.lock.Unlock()
+	j.emitProgress(true)
+	return nil
+}
+
+func (j *ScanJob) Resume() error {
+	j.lock.Lock()
+	if j.state != ScanJobPaused {
+		j.lock.Unlock()
+		return fmt.Errorf("扫描任务当前状态为 %s，无法恢复", j.state)
+	}
+	j.state = ScanJobRunning
+	j.pausedDuration += time.Since(j.pausedAt)
+	close(j.resumeSignal)
+	j.resumeSignal = nil
+	j.lock.Unlock()
+	j.emitProgress(true)
+	return nil
+}
+
+// 取消扫描任务。正在处理中的文件会继续完成处理，尚未开始处理的文件将不再处理。
+func (j *ScanJob) Cancel() error {
+	j.lock.Lock()
+	if j.state != ScanJobRunning && j.state != ScanJobPaused {
+		j.lock.Unlock()
+		return fmt.Errorf("扫描任务当前状态为 %s，无法取消", j.state)
+	}
+	if j.state == ScanJobPaused {
+		j.pausedDuration += time.Since(j.pausedAt)
+	}
+	j.state = ScanJobCanceled
+	j.lock.Unlock()
+	j.cancel()
+	j.emitProgress(true)
+	return nil
+}
+
+// 结束扫描任务，根据扫描过程返回的错误确定任务的最终状态。
+func (j *ScanJob) finish(err error) {
+	j.lock.Lock()
+	switch {
+	case j.state == ScanJobCanceled:
+	case err != nil:
+		j.state = ScanJobFailed
+	default:
+		j.state = ScanJobFinished
+	}
+	j.lock.Unlock()
+	j.cancel()
+	j.emitProgress(true)
+}
+
+func (j *ScanJob) Progress() ScanJobProgress {
+	j.lock.Lock()
+	state := j.state
+	activeDuration := time.Since(j.startedAt) - j.pausedDuration
+	if state == ScanJobPaused {
+		activeDuration -= time.Since(j.pausedAt)
+	}
+	j.lock.Unlock()
+	progress := ScanJobProgress{
+		Id:             j.Id,
+		Kind:           j.Kind,
+		State:          state,
+		TotalFiles:     atomic.LoadInt64(&j.totalFiles),
+		ProcessedFiles: atomic.LoadInt64(&j.processedFiles),
+		TotalBytes:     atomic.LoadInt64(&j.totalBytes),
+		ProcessedBytes: atomic.LoadInt64(&j.processedBytes),
+		Elapsed:        int64(activeDuration.Seconds()),
+		ETA:            -1,
+		Devices:        fileIOScheduler.metrics(),
+	}
+	if activeDuration > 0 {
+		progress.Throughput = float64(progress.ProcessedBytes) / activeDuration.Seconds()
+	}
+	if progress.Throughput > 0 {
+		progress.ETA = int64(float64(progress.TotalBytes-progress.ProcessedBytes) / progress.Throughput)
+	}
+	return progress
+}
+
+// 向前端发送扫描任务的进度事件，非强制发送的事件会按照最短间隔进行节流。
+func (j *ScanJob) emitProgress(force bool) {
+	j.lock.Lock()
+	if !force && time.Since(j.lastEmittedAt) < scanJobProgressInterval {
+		j.lock.Unlock()
+		return
+	}
+	j.lastEmittedAt = time.Now()
+	j.lock.Unlock()
+	runtime.EventsEmit(j.ctx, "scan-job", j.Progress())
+}
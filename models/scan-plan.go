@@ -0,0 +1,222 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"archgrid.xyz/ag/toolsbox/serial_code/hail"
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// 已完成的扫描计划条目在积累到指定数量之后才会一次性写入数据库。
+const scanPlanFlushSize = 50
+
+type InterruptedScan struct {
+	Id             string    `json:"id"`
+	Kind           string    `json:"kind"`
+	CreatedAt      time.Time `json:"createdAt"`
+	Directories    []string  `json:"directories"`
+	TotalFiles     int64     `json:"totalFiles"`
+	ProcessedFiles int64     `json:"processedFiles"`
+	TotalBytes     int64     `json:"totalBytes"`
+	ProcessedBytes int64     `json:"processedBytes"`
+}
+
+// 记录扫描计划中已经完成的条目，多个扫描协程会同时调用。
+type scanPlanRecorder struct {
+	dbConn  *gorm.DB
+	planId  string
+	lock    sync.Mutex
+	pending []int64
+}
+
+// 创建并保存一个新的扫描计划，返回保存了条目编号的扫描目标。
+func createScanPlan(ctx context.Context, kind string, dirs []managedModelDir, targets []scanTarget) (*entities.ScanPlan, []entities.ScanPlanItem, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	hailEngine := ctx.Value("hail").(*hail.HailAlgorithm)
+	plan := entities.ScanPlan{
+		Id:    hailEngine.GeneratePrefixedString("SP"),
+		Kind:  kind,
+		State: entities.ScanPlanRunning,
+		Directories: lo.Map(dirs, func(dir managedModelDir, _ int) string {
+			return dir.Path
+		}),
+	}
+	items := lo.Map(targets, func(target scanTarget, _ int) entities.ScanPlanItem {
+		return entities.ScanPlanItem{
+			PlanId:    plan.Id,
+			ModelType: target.ModelType,
+			FullPath:  target.Path,
+			Size:      target.Size,
+		}
+	})
+	err := dbConn.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Create(&plan); result.Error != nil {
+			return result.Error
+		}
+		if len(items) > 0 {
+			if result := tx.CreateInBatches(&items, 200); result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("保存扫描计划失败，%w", err)
+	}
+	return &plan, items, nil
+}
+
+// 加载一个被中断的扫描计划，返回全部计划条目。
+func loadScanPlan(ctx context.Context, planId string) (*entities.ScanPlan, []entities.ScanPlanItem, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var plan entities.ScanPlan
+	result := dbConn.First(&plan, "id = ?", planId)
+	if result.Error != nil {
+		return nil, nil, fmt.Errorf("未找到指定的扫描计划，%w", result.Error)
+	}
+	var items []entities.ScanPlanItem
+	result = dbConn.Where("plan_id = ?", planId).Order("id").Find(&items)
+	if result.Error != nil {
+		return nil, nil, fmt.Errorf("未能加载扫描计划内容，%w", result.Error)
+	}
+	return &plan, items, nil
+}
+
+func updateScanPlanState(ctx context.Context, planId, state string) error {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	result := dbConn.Model(&entities.ScanPlan{}).Where("id = ?", planId).Update("state", state)
+	return result.Error
+}
+
+// 删除扫描计划及其全部条目。
+func removeScanPlan(ctx context.Context, planId string) error {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	return dbConn.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Where("plan_id = ?", planId).Delete(&entities.ScanPlanItem{}); result.Error != nil {
+			return result.Error
+		}
+		return tx.Unscoped().Where("id = ?", planId).Delete(&entities.ScanPlan{}).Error
+	})
+}
+
+// 应用启动时，所有仍处于运行状态的扫描计划都是在上次运行中被中断的。
+func markInterruptedScanPlans(ctx context.Context) error {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	result := dbConn.Model(&entities.ScanPlan{}).Where("state = ?", entities.ScanPlanRunning).Update("state", entities.ScanPlanInterrupted)
+	return result.Error
+}
+
+// 获取最近一次被中断的全面扫描，如果不存在被中断的扫描则返回nil。
+func fetchInterruptedScan(ctx context.Context) (*InterruptedScan, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var plan entities.ScanPlan
+	result := dbConn.Where("state = ? AND kind = ?", entities.ScanPlanInterrupted, ScanJobFullScan).Order("created_at desc").First(&plan)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("查询被中断的扫描失败，%w", result.Error)
+	}
+	var summary struct {
+		TotalFiles     int64
+		ProcessedFiles int64
+		TotalBytes     int64
+		ProcessedBytes int64
+	}
+	result = dbConn.Model(&entities.ScanPlanItem{}).
+		Select("count(*) as total_files, coalesce(sum(done), 0) as processed_files, coalesce(sum(size), 0) as total_bytes, coalesce(sum(case when done then size else 0 end), 0) as processed_bytes").
+		Where("plan_id = ?", plan.Id).
+		Scan(&summary)
+	if result.Error != nil {
+		return nil, fmt.Errorf("统计被中断的扫描进度失败，%w", result.Error)
+	}
+	return &InterruptedScan{
+		Id:             plan.Id,
+		Kind:           plan.Kind,
+		CreatedAt:      plan.CreatedAt,
+		Directories:    plan.Directories,
+		TotalFiles:     summary.TotalFiles,
+		ProcessedFiles: summary.ProcessedFiles,
+		TotalBytes:     summary.TotalBytes,
+		ProcessedBytes: summary.ProcessedBytes,
+	}, nil
+}
+
+func newScanPlanRecorder(ctx context.Context, planId string) *scanPlanRecorder {
+	return &scanPlanRecorder{
+		dbConn:  ctx.Value(db.DBConnection).(*gorm.DB),
+		planId:  planId,
+		pending: make([]int64, 0, scanPlanFlushSize),
+	}
+}
+
+func (r *scanPlanRecorder) markDone(itemId int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.pending = append(r.pending, itemId)
+	if len(r.pending) >= scanPlanFlushSize {
+		r.flushLocked()
+	}
+}
+
+func (r *scanPlanRecorder) flush() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.flushLocked()
+}
+
+func (r *scanPlanRecorder) flushLocked() {
+	if len(r.pending) == 0 {
+		return
+	}
+	result := r.dbConn.Model(&entities.ScanPlanItem{}).Where("plan_id = ? AND id IN ?", r.planId, r.pending).Update("done", true)
+	if result.Error != nil {
+		// 未能记录的条目会在恢复扫描时重新处理，由于文件指纹的存在，重新处理的代价很小。
+		return
+	}
+	r.pending = r.pending[:0]
+}
+
+// 继续执行被中断的全面扫描，只处理扫描计划中尚未完成的文件。
+func resumeInterruptedScan(ctx context.Context, planId string) error {
+	plan, items, err := loadScanPlan(ctx, planId)
+	if err != nil {
+		return err
+	}
+	if plan.State != entities.ScanPlanInterrupted {
+		return fmt.Errorf("扫描计划 %s 并未被中断", planId)
+	}
+	job, err := registerScanJob(ctx, plan.Kind)
+	if err != nil {
+		return err
+	}
+	if err := updateScanPlanState(ctx, plan.Id, entities.ScanPlanRunning); err != nil {
+		runtime.LogErrorf(ctx, "更新扫描计划状态失败，%s", err)
+	}
+	runtime.LogInfof(ctx, "继续被中断的扫描计划 %s", plan.Id)
+	err = runFullScan(job, plan, items)
+	finishScanPlan(ctx, job, plan.Id, err)
+	return err
+}
+
+// 根据扫描任务的结束状态处理扫描计划。正常完成和被用户主动取消的扫描不再需要继续，扫描计划将被删除。
+func finishScanPlan(ctx context.Context, job *ScanJob, planId string, scanErr error) {
+	job.finish(scanErr)
+	if scanErr != nil && !errors.Is(scanErr, ErrScanJobCanceled) {
+		if err := updateScanPlanState(ctx, planId, entities.ScanPlanInterrupted); err != nil {
+			runtime.LogErrorf(ctx, "更新扫描计划状态失败，%s", err)
+		}
+		return
+	}
+	if err := removeScanPlan(ctx, planId); err != nil {
+		runtime.LogErrorf(ctx, "删除已完成的扫描计划失败，%s", err)
+	}
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// 全文检索索引中一个文件对应的文档内容。
+type fileSearchDocument struct {
+	FileId      string
+	Name        string
+	Description string
+	Tags        string
+	Prompts     string
+	Memo        string
+	Base        string
+}
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// 组装文件对应的检索文档，文件缓存需要使用`RelatedModel`和`RelatedModel.Model`关联查询。
+func buildSearchDocument(cache entities.FileCache, tags []string) fileSearchDocument {
+	var (
+		names   = []string{strings.TrimSuffix(cache.FileName, filepath.Ext(cache.FileName))}
+		prompts = append([]string{}, cache.AdditionalPrompts...)
+		bases   = make([]string, 0)
+		doc     = fileSearchDocument{FileId: cache.Id, Tags: strings.Join(tags, ", ")}
+	)
+	if cache.RelatedModelVersionId != nil && cache.RelatedModel != nil && cache.RelatedModel.Id != 0 {
+		names = append(names, cache.RelatedModel.VersionName)
+		prompts = append(prompts, cache.RelatedModel.ActivatePrompt...)
+		if cache.RelatedModel.BaseModel != nil {
+			bases = append(bases, *cache.RelatedModel.BaseModel)
+		}
+		if cache.RelatedModel.Model != nil {
+			names = append(names, cache.RelatedModel.Model.Name)
+			if cache.RelatedModel.Model.Description != nil {
+				doc.Description = htmlTagPattern.ReplaceAllString(*cache.RelatedModel.Model.Description, " ")
+			}
+		}
+	}
+	if cache.BaseModel != nil {
+		bases = append(bases, *cache.BaseModel)
+	}
+	doc.Name = strings.Join(lo.Compact(names), " ")
+	doc.Prompts = strings.Join(lo.Compact(prompts), ", ")
+	doc.Base = strings.Join(lo.Uniq(bases), " ")
+	doc.Memo = lo.FromPtrOr(cache.Memo, "")
+	return doc
+}
+
+// 重新生成指定文件的检索文档。
+func reindexFileCaches(dbConn *gorm.DB, fileIds ...string) error {
+	if len(fileIds) == 0 {
+		return nil
+	}
+	for _, idGroup := range lo.Chunk(fileIds, 50) {
+		var caches []entities.FileCache
+		result := dbConn.Joins("RelatedModel").Joins("RelatedModel.Model").Where("file_caches.id IN ?", idGroup).Find(&caches)
+		if result.Error != nil {
+			return fmt.Errorf("未能加载需要索引的文件记录，%w", result.Error)
+		}
+		modelIds := lo.Uniq(lo.FilterMap(caches, func(cache entities.FileCache, _ int) (int, bool) {
+			if cache.RelatedModel == nil || cache.RelatedModel.ModelId == nil {
+				return 0, false
+			}
+			return *cache.RelatedModel.ModelId, true
+		}))
+		var modelTags []entities.ModelTags
+		if len(modelIds) > 0 {
+			dbConn.Where("model_id IN ?", modelIds).Find(&modelTags)
+		}
+		tagsOfModel := lo.GroupBy(modelTags, func(tag entities.ModelTags) int {
+			return tag.ModelId
+		})
+		err := dbConn.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("DELETE FROM "+db.FileSearchTable+" WHERE file_id IN ?", idGroup).Error; err != nil {
+				return err
+			}
+			for _, cache := range caches {
+				var tags []string
+				if cache.RelatedModel != nil && cache.RelatedModel.ModelId != nil {
+					tags = lo.Map(tagsOfModel[*cache.RelatedModel.ModelId], func(tag entities.ModelTags, _ int) string {
+						return tag.Tag
+					})
+				}
+				doc := buildSearchDocument(cache, tags)
+				err := tx.Exec("INSERT INTO "+db.FileSearchTable+" (file_id, name, description, tags, prompts, memo, base) VALUES (?, ?, ?, ?, ?, ?, ?)",
+					doc.FileId, doc.Name, doc.Description, doc.Tags, doc.Prompts, doc.Memo, doc.Base).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("未能更新全文检索索引，%w", err)
+		}
+	}
+	return nil
+}
+
+// 重新生成关联到指定模型版本的全部文件的检索文档。
+func reindexVersionFiles(dbConn *gorm.DB, versionIds ...int) error {
+	var fileIds []string
+	result := dbConn.Model(&entities.FileCache{}).Where("related_model_version_id IN ?", versionIds).Pluck("id", &fileIds)
+	if result.Error != nil {
+		return fmt.Errorf("未能查询模型版本关联的文件，%w", result.Error)
+	}
+	return reindexFileCaches(dbConn, fileIds...)
+}
+
+// 重新生成关联到指定模型的全部文件的检索文档。
+func reindexModelFiles(dbConn *gorm.DB, modelId int) error {
+	var versionIds []int
+	result := dbConn.Model(&entities.ModelVersion{}).Where("model_id = ?", modelId).Pluck("id", &versionIds)
+	if result.Error != nil {
+		return fmt.Errorf("未能查询模型的版本，%w", result.Error)
+	}
+	if len(versionIds) == 0 {
+		return nil
+	}
+	return reindexVersionFiles(dbConn, versionIds...)
+}
+
+func removeFromSearchIndex(dbConn *gorm.DB, fileIds ...string) error {
+	if len(fileIds) == 0 {
+		return nil
+	}
+	return dbConn.Exec("DELETE FROM "+db.FileSearchTable+" WHERE file_id IN ?", fileIds).Error
+}
+
+// 清理索引中已经不存在对应文件记录的检索文档。
+func pruneSearchIndex(dbConn *gorm.DB) error {
+	return dbConn.Exec("DELETE FROM " + db.FileSearchTable + " WHERE file_id NOT IN (SELECT id FROM file_caches WHERE deleted_at IS NULL)").Error
+}
+
+// 索引的维护不影响数据本身的保存，所以维护失败时只记录日志。
+func logReindexError(ctx context.Context, err error) {
+	if err != nil {
+		runtime.LogErrorf(ctx, "维护全文检索索引失败，%s", err)
+	}
+}
+
+// 重建全部文件的检索文档。
+func rebuildSearchIndex(ctx context.Context) error {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var fileIds []string
+	result := dbConn.Model(&entities.FileCache{}).Pluck("id", &fileIds)
+	if result.Error != nil {
+		return fmt.Errorf("未能查询全部文件记录，%w", result.Error)
+	}
+	if err := dbConn.Exec("DELETE FROM " + db.FileSearchTable).Error; err != nil {
+		return fmt.Errorf("未能清空全文检索索引，%w", err)
+	}
+	return reindexFileCaches(dbConn, fileIds...)
+}
+
+// 全文检索索引出现之前已经记录的文件需要在第一次启动时建立索引。
+func ensureSearchIndex(ctx context.Context) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var indexed, cached int64
+	dbConn.Raw("SELECT count(*) FROM " + db.FileSearchTable).Scan(&indexed)
+	dbConn.Model(&entities.FileCache{}).Count(&cached)
+	if indexed > 0 || cached == 0 {
+		return
+	}
+	runtime.LogInfof(ctx, "正在为 %d 个文件建立全文检索索引", cached)
+	logReindexError(ctx, rebuildSearchIndex(ctx))
+}
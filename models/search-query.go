@@ -0,0 +1,174 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"gorm.io/gorm"
+)
+
+// 检索语句中可以使用的字段限定名称与索引列的对应关系。
+var searchFieldColumns = map[string]string{
+	"name":        "name",
+	"desc":        "description",
+	"description": "description",
+	"tag":         "tags",
+	"tags":        "tags",
+	"prompt":      "prompts",
+	"prompts":     "prompts",
+	"memo":        "memo",
+	"base":        "base",
+}
+
+type searchTerm struct {
+	Column string
+	Text   string
+	Prefix bool
+}
+
+func (t searchTerm) String() string {
+	term := `"` + strings.ReplaceAll(t.Text, `"`, `""`) + `"`
+	if t.Prefix {
+		term += "*"
+	}
+	if len(t.Column) > 0 {
+		term = t.Column + " : " + term
+	}
+	return term
+}
+
+// 读取一个以双引号包围的短语，返回短语内容和短语结束之后的位置。缺少结束引号时，短语持续到语句末尾。
+func readQuotedPhrase(runes []rune, start int) (string, int) {
+	end := start + 1
+	for end < len(runes) && runes[end] != '"' {
+		end++
+	}
+	phrase := string(runes[start+1 : end])
+	if end < len(runes) {
+		end++
+	}
+	return phrase, end
+}
+
+// 将用户输入的检索语句转换为FTS5的MATCH表达式。支持以下几种形式，多个检索项之间为“与”的关系：
+//   - 普通词语：anime
+//   - 前缀匹配：anim*
+//   - 短语匹配："white hair"
+//   - 字段限定：tag:anime、base:SDXL、prompt:"white hair"、name:anim*
+//
+// 可以使用的字段有name、desc、tag、prompt、memo和base。
+func parseSearchQuery(input string) (string, error) {
+	var (
+		runes = []rune(strings.TrimSpace(input))
+		terms = make([]string, 0)
+	)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		if runes[i] == '"' {
+			phrase, next := readQuotedPhrase(runes, i)
+			i = next
+			if len(strings.TrimSpace(phrase)) > 0 {
+				terms = append(terms, searchTerm{Text: phrase}.String())
+			}
+			continue
+		}
+		start := i
+		for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '"' && runes[i] != ':' {
+			i++
+		}
+		word := string(runes[start:i])
+		term := searchTerm{}
+		if i < len(runes) && runes[i] == ':' {
+			if column, ok := searchFieldColumns[strings.ToLower(word)]; ok {
+				term.Column = column
+				i++
+				if i < len(runes) && runes[i] == '"' {
+					phrase, next := readQuotedPhrase(runes, i)
+					i = next
+					term.Text = phrase
+				} else {
+					valueStart := i
+					for i < len(runes) && !unicode.IsSpace(runes[i]) {
+						i++
+					}
+					word = string(runes[valueStart:i])
+				}
+			} else {
+				// 不是可以识别的字段，冒号作为普通词语的一部分处理。
+				for i < len(runes) && !unicode.IsSpace(runes[i]) {
+					i++
+				}
+				word = string(runes[start:i])
+			}
+		}
+		if len(term.Text) == 0 {
+			if strings.HasSuffix(word, "*") {
+				term.Prefix = true
+				word = strings.TrimRight(word, "*")
+			}
+			term.Text = word
+		}
+		if len(strings.TrimSpace(term.Text)) == 0 {
+			continue
+		}
+		terms = append(terms, term.String())
+	}
+	if len(terms) == 0 {
+		return "", errors.New("检索内容不能为空")
+	}
+	return strings.Join(terms, " AND "), nil
+}
+
+// 使用全文检索查找本地模型文件，结果按照相关程度排序。
+func searchModelFiles(ctx context.Context, input string, page, pageSize int) (*ModelFilePage, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = defaultModelFilePageSize
+	}
+	result := &ModelFilePage{
+		Items:    make([]SimpleModelDescript, 0),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	match, err := parseSearchQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := dbConn.Raw("SELECT count(*) FROM "+db.FileSearchTable+" WHERE "+db.FileSearchTable+" MATCH ?", match).Scan(&result.Total).Error; err != nil {
+		return nil, fmt.Errorf("全文检索失败，%w", err)
+	}
+	var fileIds []string
+	err = dbConn.Raw("SELECT file_id FROM "+db.FileSearchTable+" WHERE "+db.FileSearchTable+" MATCH ? ORDER BY rank LIMIT ? OFFSET ?",
+		match, pageSize, (page-1)*pageSize).Scan(&fileIds).Error
+	if err != nil {
+		return nil, fmt.Errorf("全文检索失败，%w", err)
+	}
+	if len(fileIds) == 0 {
+		return result, nil
+	}
+	var caches []entities.FileCache
+	if err := dbConn.Joins("RelatedModel").Joins("RelatedModel.Model").Where("file_caches.id IN ?", fileIds).Find(&caches).Error; err != nil {
+		return nil, fmt.Errorf("查询检索到的文件失败，%w", err)
+	}
+	cacheById := make(map[string]entities.FileCache, len(caches))
+	for _, cache := range caches {
+		cacheById[cache.Id] = cache
+	}
+	for _, fileId := range fileIds {
+		if cache, ok := cacheById[fileId]; ok {
+			result.Items = append(result.Items, describeFileCache(cache))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,246 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/config"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+)
+
+// SD WebUI在Extra Networks中为每个模型保存的用户信息，文件为与模型文件同名的`.json`文件。
+// 文件中的其他内容（例如preferred weight、negative text）不被本应用使用，但在写回时会原样保留。
+const (
+	webuiMetaActivationText = "activation text"
+	webuiMetaNotes          = "notes"
+	webuiMetaSDVersion      = "sd version"
+)
+
+// SD WebUI中可以选择的基础模型版本。
+const (
+	webuiSDVersionUnknown = "Unknown"
+	webuiSDVersion1       = "SD1"
+	webuiSDVersion2       = "SD2"
+	webuiSDVersionXL      = "SDXL"
+)
+
+// SD WebUI的基础模型版本转换为Civitai的基础模型名称时使用的名称。
+var webuiSDVersionBaseModels = map[string]string{
+	webuiSDVersion1:  inferredSD15,
+	webuiSDVersion2:  inferredSD21,
+	webuiSDVersionXL: inferredSDXL,
+}
+
+// 将Civitai的基础模型名称转换为SD WebUI的基础模型版本，SD WebUI不能区分的基础模型均为Unknown。
+func webuiSDVersion(baseModel *string) string {
+	if baseModel == nil {
+		return webuiSDVersionUnknown
+	}
+	switch name := strings.ToLower(*baseModel); {
+	case strings.HasPrefix(name, "sd 1"):
+		return webuiSDVersion1
+	case strings.HasPrefix(name, "sd 2"):
+		return webuiSDVersion2
+	case strings.HasPrefix(name, "sdxl"), strings.HasPrefix(name, "pony"), strings.HasPrefix(name, "illustrious"), strings.HasPrefix(name, "noobai"):
+		// Pony、Illustrious等模型在结构上都是SDXL模型。
+		return webuiSDVersionXL
+	default:
+		return webuiSDVersionUnknown
+	}
+}
+
+// SD WebUI使用模型文件去掉扩展名之后的路径加上`.json`作为用户信息文件的路径。
+func webuiUserMetaPath(modelFilePath string) string {
+	return strings.TrimSuffix(modelFilePath, filepath.Ext(modelFilePath)) + ".json"
+}
+
+func readWebUIUserMeta(metaPath string) (map[string]any, error) {
+	content, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	meta := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	// 保留数字的原始形式，避免写回时改变preferred weight等内容的写法。
+	decoder.UseNumber()
+	if err := decoder.Decode(&meta); err != nil {
+		return nil, fmt.Errorf("解析SD WebUI用户信息文件失败，%w", err)
+	}
+	return meta, nil
+}
+
+func writeWebUIUserMeta(metaPath string, meta map[string]any) error {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(meta); err != nil {
+		return fmt.Errorf("生成SD WebUI用户信息失败，%w", err)
+	}
+	// 先写入临时文件再替换，避免SD WebUI读取到不完整的文件。
+	tempPath := metaPath + ".tmp"
+	if err := os.WriteFile(tempPath, buffer.Bytes(), 0644); err != nil {
+		return fmt.Errorf("写入SD WebUI用户信息文件失败，%w", err)
+	}
+	if err := os.Rename(tempPath, metaPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("替换SD WebUI用户信息文件失败，%w", err)
+	}
+	return nil
+}
+
+func splitActivationText(text string) []string {
+	return lo.Filter(lo.Map(strings.Split(text, ","), func(prompt string, _ int) string {
+		return strings.TrimSpace(prompt)
+	}), func(prompt string, _ int) bool {
+		return len(prompt) > 0
+	})
+}
+
+// 将SD WebUI用户信息中的内容应用到文件记录上，用户信息中不存在的项目保持原样。
+// 第一次同步时SD WebUI的用户信息可能只是自动生成的空白内容，此时将两边的内容合并：提示词取并集，
+// 备注和手动记录的基础模型优先保留文件记录中已有的内容。返回值表示合并之后的内容是否需要写回用户信息文件。
+func applyWebUIUserMeta(file *entities.FileCache, meta map[string]any, firstSync bool) bool {
+	var needsExport bool
+	if text, ok := meta[webuiMetaActivationText].(string); ok {
+		prompts := splitActivationText(text)
+		if firstSync {
+			merged := lo.Uniq(append(append([]string{}, prompts...), file.AdditionalPrompts...))
+			needsExport = needsExport || len(merged) != len(lo.Uniq(prompts))
+			prompts = merged
+		}
+		file.AdditionalPrompts = lo.Uniq(prompts)
+	}
+	if notes, ok := meta[webuiMetaNotes].(string); ok {
+		hasNotes := len(strings.TrimSpace(notes)) > 0
+		switch {
+		case firstSync && file.Memo != nil:
+			needsExport = needsExport || *file.Memo != notes
+		default:
+			file.Memo = lo.Ternary(hasNotes, &notes, nil)
+		}
+	}
+	// 手动记录的基础模型在第一次同步时保留，推断得出的基础模型总是以SD WebUI中的选择为准。
+	manualBaseModel := file.BaseModel != nil && file.BaseModelConfidence == nil
+	if version, ok := meta[webuiMetaSDVersion].(string); ok && version != webuiSDVersion(file.BaseModel) {
+		if firstSync && manualBaseModel {
+			needsExport = true
+		} else if baseModel, known := webuiSDVersionBaseModels[version]; known {
+			// 已经记录的基础模型与SD WebUI中的版本一致时保留原有更精确的名称。
+			file.BaseModel = &baseModel
+			file.BaseModelConfidence = nil
+		}
+	}
+	return needsExport
+}
+
+// 读取模型文件对应的SD WebUI用户信息并应用到文件记录上，但不保存文件记录。
+// 用户信息文件自上次同步之后没有发生变化时不做任何处理。返回值分别表示文件记录是否被修改，
+// 以及合并之后的内容是否需要在保存文件记录之后通过`exportWebUIUserMeta`写回用户信息文件。
+func importWebUIUserMeta(file *entities.FileCache) (bool, bool, error) {
+	metaPath := webuiUserMetaPath(file.FullPath)
+	stat, err := os.Stat(metaPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, false, nil
+		}
+		return false, false, fmt.Errorf("获取SD WebUI用户信息文件状态失败，%w", err)
+	}
+	if stat.IsDir() || stat.ModTime().UnixNano() == file.UserMetaModTime {
+		return false, false, nil
+	}
+	meta, err := readWebUIUserMeta(metaPath)
+	if err != nil {
+		return false, false, err
+	}
+	needsExport := applyWebUIUserMeta(file, meta, file.UserMetaModTime == 0)
+	file.UserMetaModTime = stat.ModTime().UnixNano()
+	return true, needsExport, nil
+}
+
+// 同步已经记录过的文件对应的SD WebUI用户信息，用户信息发生变化时保存文件记录并更新检索索引。
+func refreshWebUIUserMeta(ctx context.Context, file *entities.FileCache) error {
+	changed, needsExport, err := importWebUIUserMeta(file)
+	if err != nil || !changed {
+		return err
+	}
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	result := dbConn.Model(file).
+		Select("additional_prompts", "memo", "base_model", "base_model_confidence", "user_meta_mod_time").
+		Updates(file)
+	if result.Error != nil {
+		return fmt.Errorf("保存SD WebUI用户信息失败，%w", result.Error)
+	}
+	logReindexError(ctx, reindexFileCaches(dbConn, file.Id))
+	if needsExport {
+		return exportWebUIUserMeta(ctx, file)
+	}
+	return nil
+}
+
+// 判断文件是否位于SD WebUI的模型目录及其子目录中。
+func isInWebUIModelDir(filePath string) bool {
+	filePath = filepath.Clean(filePath)
+	return lo.SomeBy(scanableModelTypes, func(modelType string) bool {
+		dirs, err := config.GetWebUIModelPath(modelType)
+		if err != nil {
+			return false
+		}
+		return lo.SomeBy(dirs, func(dir string) bool {
+			return len(dir) > 0 && strings.HasPrefix(filePath, filepath.Clean(dir)+string(filepath.Separator))
+		})
+	})
+}
+
+// 将文件记录中的提示词、备注和基础模型写回SD WebUI用户信息文件，文件中的其他内容保持不变。
+// 文件不存在时，只为SD WebUI模型目录中有需要写入的内容的文件创建用户信息文件。
+func exportWebUIUserMeta(ctx context.Context, file *entities.FileCache) error {
+	metaPath := webuiUserMetaPath(file.FullPath)
+	// 推断得出的基础模型不一定准确，只写入手动记录的基础模型。
+	manualBaseModel := file.BaseModel != nil && file.BaseModelConfidence == nil
+	meta, err := readWebUIUserMeta(metaPath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		// 只在SD WebUI的模型目录中建立新的用户信息文件，以免在只供ComfyUI使用的目录中留下SD WebUI的文件。
+		if (len(file.AdditionalPrompts) == 0 && file.Memo == nil && !manualBaseModel) || !isInWebUIModelDir(file.FullPath) {
+			return nil
+		}
+		meta = make(map[string]any)
+	}
+	meta[webuiMetaActivationText] = strings.Join(file.AdditionalPrompts, ", ")
+	meta[webuiMetaNotes] = lo.FromPtrOr(file.Memo, "")
+	// 没有手动记录基础模型的文件保留SD WebUI中原有的选择。
+	if manualBaseModel {
+		meta[webuiMetaSDVersion] = webuiSDVersion(file.BaseModel)
+	}
+	if err := writeWebUIUserMeta(metaPath, meta); err != nil {
+		return err
+	}
+	// 记录写入之后的修改时间，避免下次扫描时将刚写入的内容重新读取回来。
+	stat, err := os.Stat(metaPath)
+	if err != nil {
+		return fmt.Errorf("获取SD WebUI用户信息文件状态失败，%w", err)
+	}
+	file.UserMetaModTime = stat.ModTime().UnixNano()
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	return dbConn.Model(file).Update("user_meta_mod_time", file.UserMetaModTime).Error
+}
+
+// 用户信息只是附加的同步功能，写回失败不影响已经保存的文件记录。
+func logWebUIUserMetaError(ctx context.Context, file *entities.FileCache, err error) {
+	if err != nil {
+		runtime.LogErrorf(ctx, "同步文件 [%s] 的SD WebUI用户信息失败，%s", file.FullPath, err)
+	}
+}
@@ -0,0 +1,71 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/config"
+)
+
+// Civitai要求登录才能访问时返回的错误，通常是需要登录才能下载的模型或者处于抢先体验阶段的模型。
+var ErrAuthenticationRequired = errors.New("Civitai要求登录后才能访问，请在设置中填写有效的Civitai API密钥")
+
+// 判断主机名是否是Civitai官方的域名，即civitai.com及其子域名。
+func isOfficialCivitaiHost(host string) bool {
+	host = strings.ToLower(host)
+	return host == "civitai.com" || strings.HasSuffix(host, ".civitai.com")
+}
+
+// 判断请求的目标是否是Civitai，包括Civitai及其子域名，以及用户自行配置的镜像或者缓存代理。
+func isCivitaiHost(host string) bool {
+	return isOfficialCivitaiHost(host) || isConfiguredCivitaiHost(host)
+}
+
+// 判断是否可以向请求的目标发送API密钥。API密钥默认只发送给Civitai官方域名，
+// 镜像或者缓存代理需要在配置中明确允许，并且只能通过https发送。
+func isAPIKeyAllowed(target *url.URL) bool {
+	host := target.Hostname()
+	if isOfficialCivitaiHost(host) {
+		return true
+	}
+	return target.Scheme == "https" && lo.Contains(config.CivitaiAPIKeyHosts(), strings.ToLower(host))
+}
+
+// 为发往Civitai的请求附加API密钥。Civitai的下载地址会重定向到其他域名的存储服务，
+// Go的HTTP客户端在跨域名重定向时不会转发Authorization头，密钥不会泄露到其他域名。
+func authorizeCivitaiRequest(request *http.Request) {
+	if !isAPIKeyAllowed(request.URL) {
+		return
+	}
+	if apiKey := config.CivitaiAPIKey(); len(apiKey) > 0 {
+		request.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+// 检查Civitai的响应是否表示需要登录。未登录下载需要登录的模型时，Civitai会重定向到登录页面而不是返回错误状态码。
+func checkCivitaiAuthentication(resp *http.Response) error {
+	if resp.Request == nil {
+		return nil
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		// 只有会收到API密钥的主机返回的401和403才表示需要登录。其他主机，例如签名已经过期的存储服务地址或者镜像，
+		// 返回的401和403作为普通的错误处理，以便继续尝试其他访问地址。
+		if !isAPIKeyAllowed(resp.Request.URL) {
+			resp.Body.Close()
+			return fmt.Errorf("远程服务拒绝访问，HTTP状态码：%d", resp.StatusCode)
+		}
+	case isCivitaiHost(resp.Request.URL.Hostname()) && strings.HasPrefix(resp.Request.URL.Path, "/login"):
+	default:
+		return nil
+	}
+	resp.Body.Close()
+	if len(config.CivitaiAPIKey()) > 0 {
+		return fmt.Errorf("%w（已经配置的API密钥无效或者没有访问权限，HTTP状态码：%d）", ErrAuthenticationRequired, resp.StatusCode)
+	}
+	return ErrAuthenticationRequired
+}
@@ -0,0 +1,84 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/config"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// 判断主机名是否属于已配置的API地址或者下载地址。
+func isConfiguredCivitaiHost(host string) bool {
+	return lo.SomeBy(append(config.CivitaiAPIBases(), config.CivitaiDownloadHosts()...), func(endpoint string) bool {
+		parsed, err := url.Parse(endpoint)
+		return err == nil && strings.EqualFold(parsed.Hostname(), host)
+	})
+}
+
+// 把使用首选API地址组装的访问地址转换为全部已配置API地址上的对应地址，按照尝试顺序排列。
+func civitaiApiCandidates(targetUrl string) []string {
+	bases := config.CivitaiAPIBases()
+	if !strings.HasPrefix(targetUrl, bases[0]) {
+		return []string{targetUrl}
+	}
+	apiPath := strings.TrimPrefix(targetUrl, bases[0])
+	return lo.Map(bases, func(base string, _ int) string {
+		return base + apiPath
+	})
+}
+
+// 把Civitai官方的模型下载地址转换为全部已配置下载地址上的对应地址，按照尝试顺序排列。
+// 镜像返回的下载地址已经指向镜像本身，不会被替换。
+func civitaiDownloadCandidates(targetUrl string) []string {
+	parsed, err := url.Parse(targetUrl)
+	if err != nil || !isOfficialCivitaiHost(parsed.Hostname()) {
+		return []string{targetUrl}
+	}
+	requestPath := parsed.RequestURI()
+	return lo.Map(config.CivitaiDownloadHosts(), func(host string, _ int) string {
+		return host + requestPath
+	})
+}
+
+// 判断响应是否表示访问地址暂时无法使用，此时可以尝试下一个地址。
+func endpointUnavailable(resp *http.Response) bool {
+	return resp.StatusCode >= http.StatusInternalServerError || retryableStatusCodes[resp.StatusCode]
+}
+
+// 依次尝试各个访问地址，前面的地址在重试之后仍然无法访问或者暂时不可用时使用下一个地址。
+// 需要登录以及资源不存在等明确的响应不会再尝试其他地址。
+func fetchWithFallback(ctx context.Context, request remoteRequest, candidates []string) (*http.Response, error) {
+	for i, candidate := range candidates {
+		request.Url = candidate
+		resp, err := fetchRemote(ctx, request)
+		isLast := i == len(candidates)-1
+		if err == nil && (isLast || !endpointUnavailable(resp)) {
+			return resp, nil
+		}
+		if err != nil && (isLast || errors.Is(err, ErrAuthenticationRequired) || ctx.Err() != nil) {
+			return nil, err
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = fmt.Errorf("HTTP状态码：%d", resp.StatusCode)
+		}
+		runtime.LogWarningf(ctx, "访问地址 [%s] 失败，%s，尝试使用下一个地址 [%s]", candidate, err, candidates[i+1])
+	}
+	return nil, errors.New("没有可以使用的访问地址")
+}
+
+// 访问Civitai API，请求地址需要使用`models`包中的函数以首选API地址组装。
+func fetchCivitaiApi(ctx context.Context, request remoteRequest) (*http.Response, error) {
+	return fetchWithFallback(ctx, request, civitaiApiCandidates(request.Url))
+}
+
+// 下载Civitai中的模型文件。
+func fetchCivitaiDownload(ctx context.Context, request remoteRequest) (*http.Response, error) {
+	return fetchWithFallback(ctx, request, civitaiDownloadCandidates(request.Url))
+}
@@ -3,6 +3,7 @@ package remote
 import (
 	"context"
 
+	"github.com/vixalie/sd-content-manager/config"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
@@ -16,6 +17,8 @@ func NewRemoteController() *RemoteController {
 
 func (r *RemoteController) SetContext(ctx context.Context) {
 	r.ctx = ctx
+	// 代理或者网络配置变化之后，需要重新建立共用的HTTP客户端。
+	config.OnConfigurationChanged(remoteClient.reload)
 }
 
 func (r RemoteController) RefreshModelInfo(modelId int) error {
@@ -38,3 +41,15 @@ func (r RemoteController) RecheckModelExistence(modelId int) error {
 func (r RemoteController) BatchUpdateModelInfo() error {
 	return batchUpdateModelInfo(r.ctx)
 }
+
+func (r RemoteController) SearchRemoteModels(options ModelSearchOptions) (*ModelSearchResult, error) {
+	return searchRemoteModels(r.ctx, options)
+}
+
+func (r RemoteController) PersistRemoteSearchResult(pageKey string, modelId int) error {
+	return persistSearchResult(r.ctx, pageKey, modelId)
+}
+
+func (r RemoteController) ClearRemoteSearchCache() error {
+	return clearSearchCache(r.ctx)
+}
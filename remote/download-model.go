@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,6 +15,7 @@ import (
 	"github.com/vixalie/sd-content-manager/config"
 	"github.com/vixalie/sd-content-manager/db"
 	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/vixalie/sd-content-manager/models"
 	"github.com/vixalie/sd-content-manager/utils"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"gorm.io/gorm"
@@ -31,6 +31,7 @@ func downloadModelVersion(ctx context.Context, uiTools, targetCatePath, fileName
 	if len(modelVersion.PrimaryFile.IdentityHash) == 0 && len(modelVersion.Files[0].IdentityHash) == 0 {
 		return fmt.Errorf("模型版本未指定首要文件且文件列表首位文件同样不存在。")
 	}
+	models.WarnLicenseRestrictions(ctx, modelVersion.Model, models.LicenseActionDownload)
 	ui := config.MatchSoftware(uiTools)
 	targetModelPath := filepath.Join(config.ApplicationSetup.CommonPaths()[ui][strings.ToLower(modelVersion.Model.Type)], targetCatePath)
 	runtime.LogDebugf(ctx, "下载检查点0：目标路径：%s, %s", targetModelPath, fileName)
@@ -85,29 +86,13 @@ func downloadModelVersionPrimaryFile(ctx context.Context, wg *sync.WaitGroup, mo
 	}
 	runtime.LogDebug(ctx, "下载检查点1：文件齐备")
 	defer file.Close()
-	client := http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(config.GetProxyUrl()),
-		},
-	}
-	requst := http.Request{
-		Method: "GET",
-	}
-	downloadUrl, err := url.Parse(*modelVersion.DownloadUrl)
-	if err != nil {
-		runtime.EventsEmit(ctx, "model-primary-file-download-error", fmt.Errorf("无法解析下载地址，%w", err))
-		return
-	}
-	requst.URL = downloadUrl
 	header := http.Header{}
-	header.Add("User-Agent", "Mozilla/5.0 (iPad; CPU OS 12_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148")
 	if startOffset > 0 {
 		header.Add("Range", fmt.Sprintf("bytes=%d-", startOffset))
 	}
 	runtime.LogDebugf(ctx, "下载请求头：%+v", header)
-	requst.Header = header
 	runtime.LogDebug(ctx, "下载检查点2：请求准备完成")
-	resp, err := client.Do(&requst)
+	resp, err := fetchCivitaiDownload(ctx, remoteRequest{Url: *modelVersion.DownloadUrl, Header: header})
 	if err != nil {
 		runtime.EventsEmit(ctx, "model-primary-file-download-error", fmt.Sprintf("无法访问Civitai，%s", err.Error()))
 		return
@@ -149,17 +134,13 @@ func downloadModelVersionThumbnail(ctx context.Context, wg *sync.WaitGroup, mode
 		runtime.LogInfo(ctx, "未找到指定的封面图片，使用第一张图片作为封面。")
 		usedCover = modelVersion.Covers[0]
 	}
-	client := http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(config.GetProxyUrl()),
-		},
-	}
-	resp, err := client.Get(usedCover.DownloadUrl)
+	resp, err := fetchRemote(ctx, remoteRequest{Url: usedCover.DownloadUrl})
 	if err != nil {
 		runtime.LogErrorf(ctx, "无法访问Civitai，%s", err.Error())
 		runtime.EventsEmit(ctx, "model-preview-download-error", fmt.Errorf("无法访问Civitai，%w", err))
 		return
 	}
+	defer resp.Body.Close()
 	var imageFileName string
 	switch resp.Header.Get("Content-Type") {
 	case "image/png":
@@ -188,7 +169,7 @@ func downloadModelVersionThumbnail(ctx context.Context, wg *sync.WaitGroup, mode
 		}
 	}
 	defer file.Close()
-	if _, err = io.Copy(file, resp.Body); err != nil {
+	if _, err = io.Copy(file, limitedBody(resp)); err != nil {
 		runtime.EventsEmit(ctx, "model-preview-download-error", fmt.Errorf("保存缩略图文件失败，%w", err))
 		return
 	}
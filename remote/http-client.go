@@ -0,0 +1,257 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vixalie/sd-content-manager/config"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// 全部远程请求使用的User-Agent。
+const userAgent = "SD-Content-Manager (+https://github.com/vixalie/sd-content-manager)"
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+var (
+	ErrResponseTooLarge = errors.New("远程服务返回的内容超过了允许的最大数据量")
+	ErrReadTimeout      = errors.New("读取远程服务返回的内容超时")
+)
+
+// 远程服务暂时无法处理请求时返回的状态码，遇到这些状态码时会进行重试。
+var retryableStatusCodes = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// 全部远程请求共用的HTTP客户端，代理和超时配置变化之后会重新建立。
+type sharedHttpClient struct {
+	lock      sync.RWMutex
+	client    *http.Client
+	transport *http.Transport
+	settings  config.NetworkConfig
+}
+
+var remoteClient = &sharedHttpClient{}
+
+// 请求编号，用于在日志中追踪同一请求的各个阶段。
+var requestSerial uint64
+
+func buildTransport(settings config.NetworkConfig) *http.Transport {
+	connectTimeout := time.Duration(settings.ConnectTimeoutSeconds) * time.Second
+	return &http.Transport{
+		Proxy: http.ProxyURL(config.GetProxyUrl()),
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: time.Duration(settings.ReadTimeoutSeconds) * time.Second,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConnsPerHost:   8,
+		IdleConnTimeout:       90 * time.Second,
+	}
+}
+
+// 获取当前使用的客户端，第一次使用时按照当前配置建立。
+func (c *sharedHttpClient) current() (*http.Client, config.NetworkConfig) {
+	c.lock.RLock()
+	if c.client != nil {
+		defer c.lock.RUnlock()
+		return c.client, c.settings
+	}
+	c.lock.RUnlock()
+	c.reload()
+	return c.current()
+}
+
+// 按照最新的配置重新建立客户端，正在进行的请求会在原有的连接上完成。
+func (c *sharedHttpClient) reload() {
+	settings := config.NetworkSettings()
+	transport := buildTransport(settings)
+	c.lock.Lock()
+	previous := c.transport
+	c.transport = transport
+	c.client = &http.Client{Transport: transport}
+	c.settings = settings
+	c.lock.Unlock()
+	if previous != nil {
+		previous.CloseIdleConnections()
+	}
+}
+
+// 一次远程GET请求。
+type remoteRequest struct {
+	Url    string
+	Header http.Header
+	// 每次重试之前调用，attempt为即将进行的重试次数，err为上一次请求失败的原因。
+	OnRetry func(attempt int, err error)
+}
+
+// 计算重试之前等待的时间，服务端通过Retry-After指定了等待时间时优先使用。
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	delay := retryBaseDelay << attempt
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// 使用共用的客户端发送GET请求。网络错误和服务端暂时不可用时按照配置的次数重试，每次重试之间的等待时间逐渐增加。
+// 发往Civitai的请求会附带API密钥，需要登录时返回ErrAuthenticationRequired，其他主机返回401或者403时返回普通的错误。其他状态码由调用者自行处理。
+// 返回的响应内容在超过读取超时时间没有收到数据时会返回ErrReadTimeout，调用者需要关闭响应内容。
+func fetchRemote(ctx context.Context, request remoteRequest) (*http.Response, error) {
+	client, settings := remoteClient.current()
+	serial := atomic.AddUint64(&requestSerial, 1)
+	readTimeout := time.Duration(settings.ReadTimeoutSeconds) * time.Second
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		httpRequest, err := http.NewRequestWithContext(attemptCtx, http.MethodGet, request.Url, nil)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("无法解析访问地址，%w", err)
+		}
+		for key, values := range request.Header {
+			for _, value := range values {
+				httpRequest.Header.Add(key, value)
+			}
+		}
+		httpRequest.Header.Set("User-Agent", userAgent)
+		authorizeCivitaiRequest(httpRequest)
+		runtime.LogDebugf(ctx, "[HTTP #%d] GET %s，第%d次请求", serial, request.Url, attempt+1)
+		startAt := time.Now()
+		resp, err := client.Do(httpRequest)
+		if err == nil {
+			runtime.LogDebugf(ctx, "[HTTP #%d] 响应状态码：%d，耗时：%s", serial, resp.StatusCode, time.Since(startAt))
+			if authErr := checkCivitaiAuthentication(resp); authErr != nil {
+				cancel()
+				return nil, authErr
+			}
+			if !retryableStatusCodes[resp.StatusCode] || attempt >= settings.MaxRetries {
+				resp.Body = newTracedBody(ctx, serial, resp.Body, cancel, readTimeout, startAt)
+				return resp, nil
+			}
+			err = fmt.Errorf("远程服务暂时不可用，HTTP状态码：%d", resp.StatusCode)
+			resp.Body.Close()
+		} else {
+			runtime.LogDebugf(ctx, "[HTTP #%d] 请求失败，耗时：%s，%s", serial, time.Since(startAt), err)
+		}
+		cancel()
+		if ctx.Err() != nil || attempt >= settings.MaxRetries {
+			return nil, err
+		}
+		delay := retryDelay(attempt, resp)
+		runtime.LogWarningf(ctx, "[HTTP #%d] %s，%s后重试", serial, err, delay)
+		if request.OnRetry != nil {
+			request.OnRetry(attempt+1, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// 响应内容的包装，超过读取超时时间没有收到数据时中断请求，关闭时记录读取的数据量和总耗时。
+type tracedBody struct {
+	ctx       context.Context
+	serial    uint64
+	body      io.ReadCloser
+	cancel    context.CancelFunc
+	timer     *time.Timer
+	timeout   time.Duration
+	timedOut  int32
+	bytesRead int64
+	startAt   time.Time
+	closeOnce sync.Once
+}
+
+func newTracedBody(ctx context.Context, serial uint64, body io.ReadCloser, cancel context.CancelFunc, timeout time.Duration, startAt time.Time) *tracedBody {
+	traced := &tracedBody{
+		ctx:     ctx,
+		serial:  serial,
+		body:    body,
+		cancel:  cancel,
+		timeout: timeout,
+		startAt: startAt,
+	}
+	traced.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&traced.timedOut, 1)
+		cancel()
+	})
+	return traced
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.bytesRead += int64(n)
+	if err != nil && atomic.LoadInt32(&b.timedOut) == 1 {
+		return n, ErrReadTimeout
+	}
+	b.timer.Reset(b.timeout)
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.body.Close()
+	b.closeOnce.Do(func() {
+		b.timer.Stop()
+		b.cancel()
+		runtime.LogDebugf(b.ctx, "[HTTP #%d] 完成，读取%d字节，总耗时：%s", b.serial, b.bytesRead, time.Since(b.startAt))
+	})
+	return err
+}
+
+// 响应内容允许的最大数据量。
+func maxResponseBytes() int64 {
+	_, settings := remoteClient.current()
+	return int64(settings.MaxResponseMB) * 1024 * 1024
+}
+
+// 限制数据量的读取，超过最大数据量时返回ErrResponseTooLarge。
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.reader.Read(p)
+	if int64(n) > l.remaining {
+		n, l.remaining = int(l.remaining), 0
+		return n, ErrResponseTooLarge
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// 获取限制了最大数据量的响应内容，用于保存图片等不应该过大的内容。
+func limitedBody(resp *http.Response) io.Reader {
+	limit := maxResponseBytes()
+	// 多读取一个字节，用于判断内容是否超过了最大数据量。
+	return &limitedReader{reader: io.LimitReader(resp.Body, limit+1), remaining: limit}
+}
+
+// 读取全部响应内容并关闭响应，用于读取模型信息等接口返回的内容。
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	return io.ReadAll(limitedBody(resp))
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 
@@ -34,22 +33,18 @@ func SureImageFile(ctx context.Context, image *entities.Image) error {
 			return nil
 		}
 	}
-	client := http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(config.GetProxyUrl()),
-		},
-	}
 	downloadEvent := DownloadEvent{
 		ctx:     ctx,
 		EventId: image.Id,
 	}
 	downloadEvent.Start()
-	resp, err := client.Get(image.DownloadUrl)
+	resp, err := fetchRemote(ctx, remoteRequest{Url: image.DownloadUrl})
 	if err != nil {
 		fmt.Printf("无法访问Civitai，%s", err.Error())
 		downloadEvent.Failed(fmt.Errorf("无法访问Civitai，%w", err))
 		return fmt.Errorf("无法访问Civitai，%w", err)
 	}
+	defer resp.Body.Close()
 	imageFilePath := filepath.Join(config.SettingPath, "model-images")
 	if err := os.MkdirAll(imageFilePath, os.ModePerm); err != nil {
 		fmt.Printf("创建图片文件保存目录失败，%s", err.Error())
@@ -75,7 +70,7 @@ func SureImageFile(ctx context.Context, image *entities.Image) error {
 		return fmt.Errorf("创建图片文件失败，%w", err)
 	}
 	defer targetFile.Close()
-	if _, err := io.Copy(targetFile, io.TeeReader(resp.Body, &downloadEvent)); err != nil {
+	if _, err := io.Copy(targetFile, io.TeeReader(limitedBody(resp), &downloadEvent)); err != nil {
 		fmt.Printf("保存图片文件失败，%s", err.Error())
 		downloadEvent.Failed(fmt.Errorf("保存图片文件失败，%w", err))
 		return fmt.Errorf("保存图片文件失败，%w", err)
@@ -3,12 +3,11 @@ package remote
 import (
 	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"sync"
 	"time"
 
-	"github.com/vixalie/sd-content-manager/config"
+	"github.com/samber/lo"
 	"github.com/vixalie/sd-content-manager/db"
 	"github.com/vixalie/sd-content-manager/entities"
 	"github.com/vixalie/sd-content-manager/models"
@@ -20,15 +19,11 @@ import (
 func RefreshModelInfo(ctx context.Context, modelId int) error {
 	modelInfoUrl := models.AssembleModelUrl(modelId)
 	runtime.LogDebugf(ctx, "刷新模型信息，URL：%s", modelInfoUrl)
-	client := http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(config.GetProxyUrl()),
-		},
-	}
-	resp, err := client.Get(modelInfoUrl)
+	resp, err := fetchCivitaiApi(ctx, remoteRequest{Url: modelInfoUrl})
 	if err != nil {
 		return fmt.Errorf("无法访问Civitai，%w", err)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		if resp.StatusCode == http.StatusNotFound {
 			runtime.EventsEmit(ctx, "model-found", "not-found")
@@ -42,7 +37,7 @@ func RefreshModelInfo(ctx context.Context, modelId int) error {
 	} else {
 		runtime.EventsEmit(ctx, "model-found", "found")
 	}
-	originalModelContent, err := io.ReadAll(resp.Body)
+	originalModelContent, err := readResponseBody(resp)
 	if err != nil {
 		return fmt.Errorf("无法读取Civitai返回内容，%w", err)
 	}
@@ -63,8 +58,8 @@ type BatchUpdateEventPayload struct {
 
 func batchUpdateModelInfo(ctx context.Context) error {
 	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
-	var models []entities.Model
-	result := dbConn.Find(&models)
+	var cachedModels []entities.Model
+	result := dbConn.Find(&cachedModels)
 	if result.Error != nil {
 		return fmt.Errorf("无法获取模型列表，%w", result.Error)
 	}
@@ -74,11 +69,16 @@ func batchUpdateModelInfo(ctx context.Context) error {
 		taskQueue = make([]entities.Model, 0)
 		now       = time.Now()
 	)
-	for _, model := range models {
+	for _, model := range cachedModels {
 		if !model.CivitailDeleted && (model.LastSyncedAt == nil || model.LastSyncedAt.Add(30*24*time.Hour).Before(now)) {
 			taskQueue = append(taskQueue, model)
 		}
 	}
+	// 记录更新之前已经知道的新版本，更新完成之后只通知新发现的版本。
+	knownUpdates, err := models.ListModelUpdates(ctx)
+	if err != nil {
+		runtime.LogErrorf(ctx, "查询可用的模型更新失败，%s", err)
+	}
 	wg.Add(len(taskQueue))
 	for _, model := range taskQueue {
 		if err := semaphore.Acquire(ctx, 1); err != nil {
@@ -88,55 +88,80 @@ func batchUpdateModelInfo(ctx context.Context) error {
 	}
 	wg.Wait()
 	runtime.EventsEmit(ctx, "model-update-all-done", "")
+	notifyDiscoveredUpdates(ctx, knownUpdates)
 	return nil
 }
 
+// 比较批量更新前后可用的模型更新，存在新发现的版本时向前端发出通知。
+func notifyDiscoveredUpdates(ctx context.Context, knownUpdates []models.ModelUpdates) {
+	currentUpdates, err := models.ListModelUpdates(ctx)
+	if err != nil {
+		runtime.LogErrorf(ctx, "查询可用的模型更新失败，%s", err)
+		return
+	}
+	knownVersions := make(map[int]bool)
+	for _, modelUpdates := range knownUpdates {
+		for _, update := range modelUpdates.Updates {
+			knownVersions[update.VersionId] = true
+		}
+	}
+	discovered := make([]models.ModelUpdates, 0)
+	for _, modelUpdates := range currentUpdates {
+		modelUpdates.Updates = lo.Filter(modelUpdates.Updates, func(update models.AvailableVersionUpdate, _ int) bool {
+			return !knownVersions[update.VersionId]
+		})
+		if len(modelUpdates.Updates) > 0 {
+			discovered = append(discovered, modelUpdates)
+		}
+	}
+	if len(discovered) > 0 {
+		runtime.LogInfof(ctx, "发现%d个模型存在新版本", len(discovered))
+		runtime.EventsEmit(ctx, "model-updates-available", discovered)
+	}
+}
+
 func batchUpdateModelTask(ctx context.Context, weighted *semaphore.Weighted, wg *sync.WaitGroup, modelId int, modelName string) {
 	defer weighted.Release(1)
 	defer wg.Done()
 	defer time.Sleep(5 * time.Second)
 
-	var success bool = false
+	var (
+		success bool = false
+		retries int64
+	)
 	modelInfoUrl := models.AssembleModelUrl(modelId)
-	client := http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(config.GetProxyUrl()),
-		},
-	}
-	var retries int64
-	for retries = 0; retries < 3; retries++ {
-		runtime.EventsEmit(ctx, "model-update", BatchUpdateEventPayload{modelId, modelName, "start", retries, "正在获取模型信息……"})
-		var originalModelContent []byte
-		resp, err := client.Get(modelInfoUrl)
-		if err != nil {
+	runtime.EventsEmit(ctx, "model-update", BatchUpdateEventPayload{modelId, modelName, "start", retries, "正在获取模型信息……"})
+	// 网络错误和Civitai暂时不可用时的重试由共用的HTTP客户端完成。
+	resp, err := fetchCivitaiApi(ctx, remoteRequest{
+		Url: modelInfoUrl,
+		OnRetry: func(attempt int, err error) {
 			runtime.EventsEmit(ctx, "model-update", BatchUpdateEventPayload{modelId, modelName, "error", retries, fmt.Sprintf("无法访问Civitai，%s", err.Error())})
-			goto RETRY_DELAY
-		}
-		if resp.StatusCode != http.StatusOK {
-			if resp.StatusCode == http.StatusNotFound {
-				dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
-				dbConn.Model(&entities.Model{}).Where("id = ?", modelId).Update("civitail_deleted", true)
-				success = true
-				break
-			}
-			runtime.EventsEmit(ctx, "model-update", BatchUpdateEventPayload{modelId, modelName, "error", retries, fmt.Sprintf("Civitai返回错误状态码：%d", resp.StatusCode)})
-			goto RETRY_DELAY
-		}
-		originalModelContent, err = io.ReadAll(resp.Body)
+			retries = int64(attempt)
+			runtime.EventsEmit(ctx, "model-update", BatchUpdateEventPayload{modelId, modelName, "start", retries, "正在获取模型信息……"})
+		},
+	})
+	switch {
+	case err != nil:
+		runtime.EventsEmit(ctx, "model-update", BatchUpdateEventPayload{modelId, modelName, "error", retries, fmt.Sprintf("无法访问Civitai，%s", err.Error())})
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+		dbConn.Model(&entities.Model{}).Where("id = ?", modelId).Update("civitail_deleted", true)
+		success = true
+	case resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		runtime.EventsEmit(ctx, "model-update", BatchUpdateEventPayload{modelId, modelName, "error", retries, fmt.Sprintf("Civitai返回错误状态码：%d", resp.StatusCode)})
+	default:
+		originalModelContent, err := readResponseBody(resp)
 		if err != nil {
 			runtime.EventsEmit(ctx, "model-update", BatchUpdateEventPayload{modelId, modelName, "error", retries, fmt.Sprintf("无法读取Civitai返回内容，%s", err.Error())})
-			goto RETRY_DELAY
+			break
 		}
-		_, err = models.ParseRemoteModelResponse(ctx, originalModelContent)
-		if err != nil {
+		if _, err = models.ParseRemoteModelResponse(ctx, originalModelContent); err != nil {
 			runtime.EventsEmit(ctx, "model-update", BatchUpdateEventPayload{modelId, modelName, "error", retries, fmt.Sprintf("解析Civitai返回内容失败，%s", err.Error())})
-			goto RETRY_DELAY
-		} else {
-			success = true
 			break
 		}
-	RETRY_DELAY:
-		time.Sleep(time.Duration(5*intPow(3, retries)) * time.Second)
+		success = true
 	}
 	if success {
 		runtime.EventsEmit(ctx, "model-update", BatchUpdateEventPayload{modelId, modelName, "success", 0, "模型信息更新成功。"})
@@ -144,14 +169,3 @@ func batchUpdateModelTask(ctx context.Context, weighted *semaphore.Weighted, wg
 		runtime.EventsEmit(ctx, "model-update", BatchUpdateEventPayload{modelId, modelName, "failed", retries, "模型信息更新失败。"})
 	}
 }
-
-func intPow(n, x int64) int64 {
-	var (
-		result int64 = 1
-		i      int64
-	)
-	for i = 1; i <= x; i++ {
-		result *= n
-	}
-	return result
-}
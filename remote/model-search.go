@@ -0,0 +1,263 @@
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/vixalie/sd-content-manager/db"
+	"github.com/vixalie/sd-content-manager/entities"
+	"github.com/vixalie/sd-content-manager/models"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+	// 在这个时间之内再次进行相同的搜索时直接使用缓存的结果。
+	searchCacheFreshness = time.Hour
+	// 超过这个时间的缓存结果会被清理。
+	searchCacheRetention = 7 * 24 * time.Hour
+)
+
+var (
+	searchSortOptions   = []string{"Highest Rated", "Most Downloaded", "Newest"}
+	searchPeriodOptions = []string{"AllTime", "Year", "Month", "Week", "Day"}
+)
+
+// Civitai模型搜索条件，除了关键词之外的条件都使用Civitai API中的取值。
+type ModelSearchOptions struct {
+	Query      string   `json:"query"`
+	Types      []string `json:"types"`      // 模型类型，例如Checkpoint、LORA、TextualInversion。
+	BaseModels []string `json:"baseModels"` // 基础模型，例如SD 1.5、SDXL 1.0。
+	Sort       string   `json:"sort"`       // 取值为Highest Rated、Most Downloaded、Newest。
+	Period     string   `json:"period"`     // 取值为AllTime、Year、Month、Week、Day。
+	NSFW       *bool    `json:"nsfw"`       // 为空时不限制。
+	Cursor     string   `json:"cursor"`     // 上一页结果中返回的游标，为空时获取第一页。
+	Limit      int      `json:"limit"`
+	Refresh    bool     `json:"refresh"` // 忽略缓存的结果，重新从Civitai获取。
+}
+
+type RemoteModelItem struct {
+	models.Model
+	Persisted bool `json:"persisted"` // 模型信息是否已经保存在数据库中。
+}
+
+type ModelSearchResult struct {
+	PageKey    string            `json:"pageKey"` // 保存搜索结果中的模型时使用。
+	Items      []RemoteModelItem `json:"items"`
+	NextCursor *string           `json:"nextCursor"` // 没有下一页时为空。
+	FromCache  bool              `json:"fromCache"`
+	FetchedAt  time.Time         `json:"fetchedAt"`
+}
+
+type searchResponse struct {
+	Items    []json.RawMessage `json:"items"`
+	Metadata struct {
+		NextCursor json.RawMessage `json:"nextCursor"` // Civitai根据搜索条件的不同会返回字符串或者数字。
+	} `json:"metadata"`
+}
+
+func sortedUniq(values []string) []string {
+	result := lo.Uniq(lo.FilterMap(values, func(value string, _ int) (string, bool) {
+		value = strings.TrimSpace(value)
+		return value, len(value) > 0
+	}))
+	sort.Strings(result)
+	return result
+}
+
+// 把搜索条件转换为Civitai API的查询参数，相同的搜索条件总是得到相同的查询参数。
+func (o ModelSearchOptions) values() (url.Values, error) {
+	query := url.Values{}
+	if keyword := strings.TrimSpace(o.Query); len(keyword) > 0 {
+		query.Set("query", keyword)
+	}
+	for _, modelType := range sortedUniq(o.Types) {
+		query.Add("types", modelType)
+	}
+	for _, baseModel := range sortedUniq(o.BaseModels) {
+		query.Add("baseModels", baseModel)
+	}
+	if len(o.Sort) > 0 {
+		if !lo.Contains(searchSortOptions, o.Sort) {
+			return nil, fmt.Errorf("不支持的排序方式：%s", o.Sort)
+		}
+		query.Set("sort", o.Sort)
+	}
+	if len(o.Period) > 0 {
+		if !lo.Contains(searchPeriodOptions, o.Period) {
+			return nil, fmt.Errorf("不支持的时间范围：%s", o.Period)
+		}
+		query.Set("period", o.Period)
+	}
+	if o.NSFW != nil {
+		query.Set("nsfw", strconv.FormatBool(*o.NSFW))
+	}
+	limit := o.Limit
+	if limit <= 0 {
+		limit = defaultSearchPageSize
+	}
+	query.Set("limit", strconv.Itoa(lo.Min([]int{limit, maxSearchPageSize})))
+	if len(o.Cursor) > 0 {
+		query.Set("cursor", o.Cursor)
+	}
+	return query, nil
+}
+
+func searchPageKey(query url.Values) string {
+	digest := sha256.Sum256([]byte(query.Encode()))
+	return hex.EncodeToString(digest[:])
+}
+
+func fetchSearchPage(ctx context.Context, query url.Values) ([]byte, error) {
+	searchUrl := models.AssembleModelSearchUrl(query)
+	runtime.LogDebugf(ctx, "搜索Civitai模型，URL：%s", searchUrl)
+	resp, err := fetchCivitaiApi(ctx, remoteRequest{Url: searchUrl})
+	if err != nil {
+		return nil, fmt.Errorf("无法访问Civitai，%w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Civitai返回错误状态码：%d", resp.StatusCode)
+	}
+	content, err := readResponseBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取Civitai返回内容，%w", err)
+	}
+	return content, nil
+}
+
+// 解析搜索结果页，并标记已经保存在数据库中的模型。
+func buildSearchResult(ctx context.Context, page *entities.RemoteSearchPage, fromCache bool) (*ModelSearchResult, error) {
+	var response searchResponse
+	if err := json.Unmarshal(page.Response, &response); err != nil {
+		return nil, fmt.Errorf("解析Civitai返回内容失败，%w", err)
+	}
+	result := &ModelSearchResult{
+		PageKey:   page.Id,
+		Items:     make([]RemoteModelItem, 0, len(response.Items)),
+		FromCache: fromCache,
+		FetchedAt: page.FetchedAt,
+	}
+	if cursor := string(response.Metadata.NextCursor); len(cursor) > 0 && cursor != "null" {
+		var textCursor string
+		if err := json.Unmarshal(response.Metadata.NextCursor, &textCursor); err == nil {
+			cursor = textCursor
+		}
+		result.NextCursor = &cursor
+	}
+	for _, rawItem := range response.Items {
+		var item RemoteModelItem
+		if err := json.Unmarshal(rawItem, &item.Model); err != nil {
+			return nil, fmt.Errorf("解析Civitai返回内容失败，%w", err)
+		}
+		result.Items = append(result.Items, item)
+	}
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var persistedIds []int
+	modelIds := lo.Map(result.Items, func(item RemoteModelItem, _ int) int { return item.Id })
+	if err := dbConn.Model(&entities.Model{}).Where("id IN ?", modelIds).Pluck("id", &persistedIds).Error; err != nil {
+		return nil, fmt.Errorf("查询已保存的模型失败，%w", err)
+	}
+	for i := range result.Items {
+		result.Items[i].Persisted = lo.Contains(persistedIds, result.Items[i].Id)
+	}
+	return result, nil
+}
+
+// 搜索Civitai中的模型。相同的搜索条件在一段时间之内直接使用缓存的结果，无法访问Civitai时也会使用之前缓存的结果。
+func searchRemoteModels(ctx context.Context, options ModelSearchOptions) (*ModelSearchResult, error) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	query, err := options.values()
+	if err != nil {
+		return nil, err
+	}
+	pageKey := searchPageKey(query)
+	var cached entities.RemoteSearchPage
+	hasCache := dbConn.Where("id = ?", pageKey).Limit(1).Find(&cached).RowsAffected > 0
+	if hasCache && !options.Refresh && time.Since(cached.FetchedAt) < searchCacheFreshness {
+		return buildSearchResult(ctx, &cached, true)
+	}
+	content, err := fetchSearchPage(ctx, query)
+	if err != nil {
+		if hasCache {
+			runtime.LogWarningf(ctx, "搜索Civitai模型失败，使用缓存的搜索结果，%s", err)
+			return buildSearchResult(ctx, &cached, true)
+		}
+		return nil, err
+	}
+	page := &entities.RemoteSearchPage{
+		Id:        pageKey,
+		Query:     query.Encode(),
+		Response:  content,
+		FetchedAt: time.Now(),
+	}
+	result, err := buildSearchResult(ctx, page, false)
+	if err != nil {
+		return nil, err
+	}
+	saveResult := dbConn.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"query", "response", "fetched_at", "updated_at"}),
+	}).Create(page)
+	if saveResult.Error != nil {
+		runtime.LogErrorf(ctx, "缓存Civitai搜索结果失败，%s", saveResult.Error)
+	}
+	pruneSearchCache(ctx)
+	return result, nil
+}
+
+func pruneSearchCache(ctx context.Context) {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	result := dbConn.Unscoped().Where("fetched_at < ?", time.Now().Add(-searchCacheRetention)).Delete(&entities.RemoteSearchPage{})
+	if result.Error != nil {
+		runtime.LogErrorf(ctx, "清理过期的Civitai搜索结果失败，%s", result.Error)
+	}
+}
+
+func clearSearchCache(ctx context.Context) error {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	result := dbConn.Unscoped().Where("1 = 1").Delete(&entities.RemoteSearchPage{})
+	if result.Error != nil {
+		return fmt.Errorf("清理Civitai搜索结果缓存失败，%w", result.Error)
+	}
+	return nil
+}
+
+// 把搜索结果中的模型保存到数据库中，保存之后即可使用下载模型版本的功能下载模型。
+// 搜索结果的缓存已经被清理时，直接从Civitai重新获取模型信息。
+func persistSearchResult(ctx context.Context, pageKey string, modelId int) error {
+	dbConn := ctx.Value(db.DBConnection).(*gorm.DB)
+	var page entities.RemoteSearchPage
+	if dbConn.Where("id = ?", pageKey).Limit(1).Find(&page).RowsAffected > 0 {
+		var response searchResponse
+		if err := json.Unmarshal(page.Response, &response); err != nil {
+			return fmt.Errorf("解析缓存的搜索结果失败，%w", err)
+		}
+		for _, rawItem := range response.Items {
+			var item struct {
+				Id int `json:"id"`
+			}
+			if err := json.Unmarshal(rawItem, &item); err != nil || item.Id != modelId {
+				continue
+			}
+			if _, err := models.ParseRemoteModelResponse(ctx, rawItem); err != nil {
+				return fmt.Errorf("保存模型信息失败，%w", err)
+			}
+			return nil
+		}
+	}
+	return RefreshModelInfo(ctx, modelId)
+}
@@ -3,14 +3,12 @@ package remote
 import (
 	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/samber/lo"
-	"github.com/vixalie/sd-content-manager/config"
 	"github.com/vixalie/sd-content-manager/db"
 	"github.com/vixalie/sd-content-manager/entities"
 	"github.com/vixalie/sd-content-manager/models"
@@ -21,19 +19,15 @@ import (
 func refreshModelVersionInfoByHash(ctx context.Context, hash string) (*int, error) {
 	hashInfoUrl := models.AssembleModelVersionByHashUrl(hash)
 	runtime.LogDebugf(ctx, "利用Hash刷新模型版本信息，URL：%s", hashInfoUrl)
-	client := http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(config.GetProxyUrl()),
-		},
-	}
-	resp, err := client.Get(hashInfoUrl)
+	resp, err := fetchCivitaiApi(ctx, remoteRequest{Url: hashInfoUrl})
 	if err != nil {
 		return nil, fmt.Errorf("无法访问Civitai，%w", err)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("Civitai返回错误状态码：%d", resp.StatusCode)
 	}
-	originalModelVersionContent, err := io.ReadAll(resp.Body)
+	originalModelVersionContent, err := readResponseBody(resp)
 	if err != nil {
 		return nil, fmt.Errorf("无法读取Civitai返回内容，%w", err)
 	}
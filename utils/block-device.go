@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+// 文件所在的存储设备。无法获取设备信息时，Known为false，此时Rotational没有意义。
+type BlockDevice struct {
+	Id         int64
+	Name       string
+	Rotational bool
+	Known      bool
+}
+
+// 获取指定路径所在存储设备的编号，与文件指纹中记录的设备编号相同。
+func FileDeviceId(path string) (int64, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("未能获取文件信息，%w", err)
+	}
+	_, device := fileIdentity(path, fileInfo)
+	return device, nil
+}
+
+// 获取指定编号存储设备的名称和类型。
+func DescribeBlockDevice(device int64) BlockDevice {
+	return describeBlockDevice(device)
+}
@@ -0,0 +1,38 @@
+//go:build linux
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 按照Linux内核的规则从设备编号中分解主设备号和次设备号。
+func splitDeviceNumber(device uint64) (uint64, uint64) {
+	major := (device>>8)&0xfff | (device>>32)&^uint64(0xfff)
+	minor := device&0xff | (device>>12)&^uint64(0xff)
+	return major, minor
+}
+
+// 从sysfs中读取设备的类型。分区本身没有queue目录，需要读取其所在磁盘的信息。
+func describeBlockDevice(device int64) BlockDevice {
+	blockDevice := BlockDevice{Id: device, Name: fmt.Sprintf("%d", device)}
+	major, minor := splitDeviceNumber(uint64(device))
+	devicePath, err := filepath.EvalSymlinks(fmt.Sprintf("/sys/dev/block/%d:%d", major, minor))
+	if err != nil {
+		return blockDevice
+	}
+	blockDevice.Name = filepath.Base(devicePath)
+	for _, dir := range []string{devicePath, filepath.Dir(devicePath)} {
+		content, err := os.ReadFile(filepath.Join(dir, "queue", "rotational"))
+		if err != nil {
+			continue
+		}
+		blockDevice.Rotational = strings.TrimSpace(string(content)) == "1"
+		blockDevice.Known = true
+		break
+	}
+	return blockDevice
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package utils
+
+import "fmt"
+
+// 目前只支持在Linux中判断存储设备的类型，其他平台上的设备均作为未知类型处理，读取调度会使用为未知类型设备配置的并发数量。
+func describeBlockDevice(device int64) BlockDevice {
+	return BlockDevice{Id: device, Name: fmt.Sprintf("%d", device)}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+)
+
+// 文件指纹，用于在不重新计算Hash的情况下判断文件内容是否可能发生了变化。
+type FileFingerprint struct {
+	Size    int64
+	ModTime int64 // 文件最后修改时间，以Unix纳秒时间戳表示。
+	Inode   int64
+	Device  int64
+}
+
+// 获取指定路径文件的指纹信息。Inode与Device信息的获取方式与操作系统相关，在无法获取的平台上将保持为0。
+func StatFileFingerprint(filePath string) (*FileFingerprint, error) {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("未能获取文件信息，%w", err)
+	}
+	inode, device := fileIdentity(filePath, fileInfo)
+	return &FileFingerprint{
+		Size:    fileInfo.Size(),
+		ModTime: fileInfo.ModTime().UnixNano(),
+		Inode:   inode,
+		Device:  device,
+	}, nil
+}
+
+// 判断两个文件指纹是否一致，只有全部字段都相同时才认为文件没有发生变化。
+func (f FileFingerprint) Equal(other FileFingerprint) bool {
+	return f.Size == other.Size && f.ModTime == other.ModTime && f.Inode == other.Inode && f.Device == other.Device
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// 从文件系统返回的原始Stat信息中提取Inode和所在设备编号。
+func fileIdentity(_ string, fileInfo os.FileInfo) (int64, int64) {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return int64(stat.Ino), int64(stat.Dev)
+}
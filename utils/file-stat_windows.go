@@ -0,0 +1,35 @@
+//go:build windows
+
+package utils
+
+import (
+	"os"
+	"syscall"
+)
+
+// Windows中没有Inode概念，这里使用NTFS的文件索引号和卷序列号代替Inode与设备编号。
+func fileIdentity(filePath string, _ os.FileInfo) (int64, int64) {
+	pathPtr, err := syscall.UTF16PtrFromString(filePath)
+	if err != nil {
+		return 0, 0
+	}
+	handle, err := syscall.CreateFile(
+		pathPtr,
+		0,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil,
+		syscall.OPEN_EXISTING,
+		syscall.FILE_FLAG_BACKUP_SEMANTICS,
+		0,
+	)
+	if err != nil {
+		return 0, 0
+	}
+	defer syscall.CloseHandle(handle)
+	var info syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(handle, &info); err != nil {
+		return 0, 0
+	}
+	fileIndex := uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow)
+	return int64(fileIndex), int64(info.VolumeSerialNumber)
+}
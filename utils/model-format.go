@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// 模型文件的容器格式。
+const (
+	FormatSafetensors = "safetensors"
+	FormatTorchZip    = "torch-zip" // PyTorch 1.6之后默认使用的zip格式，其中包含pickle序列化的数据。
+	FormatPickle      = "pickle"    // 直接使用pickle序列化的旧式PyTorch文件。
+	FormatGGUF        = "gguf"
+	FormatUnknown     = "unknown"
+)
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	ggufMagic = []byte("GGUF")
+)
+
+// 根据文件开头的特征字节判断模型文件的容器格式，不依赖于文件的扩展名。
+func DetectModelFormat(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return FormatUnknown, fmt.Errorf("未能打开模型文件，%w", err)
+	}
+	defer file.Close()
+	head := make([]byte, 16)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return FormatUnknown, fmt.Errorf("未能读取模型文件，%w", err)
+	}
+	return detectModelFormat(head[:n]), nil
+}
+
+func detectModelFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, ggufMagic):
+		return FormatGGUF
+	case bytes.HasPrefix(head, zipMagic):
+		return FormatTorchZip
+	case len(head) >= 2 && head[0] == 0x80 && head[1] >= 2 && head[1] <= 5:
+		// pickle协议2及以上的数据以PROTO操作码（0x80）和协议版本开头。
+		return FormatPickle
+	case len(head) >= 9 && head[8] == '{':
+		// Safetensors文件以8字节小端序的文件头长度开头，其后紧跟JSON格式的文件头。
+		headerSize := binary.LittleEndian.Uint64(head[:8])
+		if headerSize >= 2 && headerSize <= maxSafetensorsHeaderSize {
+			return FormatSafetensors
+		}
+	}
+	return FormatUnknown
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// AutoV1（A1111早期使用的模型Hash）只计算文件中从0x100000开始的0x10000个字节。
+const (
+	autoV1Offset = 0x100000
+	autoV1Length = 0x10000
+)
+
+// 计算Hash时使用的读取缓冲区大小。
+const hashBufferSize = 4 * 1024 * 1024
+
+// 一个文件的全部Hash值，均为大写Hex形式，与Civitai提供的Hash值格式保持一致。
+type FileHashes struct {
+	SHA256 string
+	CRC32  string
+	BLAKE3 string
+	AutoV1 string
+	AutoV2 string
+}
+
+// 在文件数据流中截取AutoV1需要计算的部分。
+type autoV1Writer struct {
+	hash   hash.Hash
+	offset int64
+}
+
+func (w *autoV1Writer) Write(p []byte) (int, error) {
+	start, end := w.offset, w.offset+int64(len(p))
+	w.offset = end
+	if end <= autoV1Offset || start >= autoV1Offset+autoV1Length {
+		return len(p), nil
+	}
+	from := maxInt64(autoV1Offset-start, 0)
+	to := minInt64(autoV1Offset+autoV1Length-start, int64(len(p)))
+	w.hash.Write(p[from:to])
+	return len(p), nil
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func upperHex(sum []byte) string {
+	return strings.ToUpper(hex.EncodeToString(sum))
+}
+
+// 计算Hash时的读取选项。
+type HashOptions struct {
+	ReadAheadBytes int64     // 在计算Hash的同时预先读取的数据量，不大于0时不进行预读。
+	OnRead         func(int) // 每次从文件中读取数据之后调用，参数为读取的字节数量，可以用来统计读取速度。
+}
+
+type readChunk struct {
+	data []byte
+	err  error
+}
+
+// 从文件中逐块读取数据交给consume处理。启用预读时，读取在独立的协程中进行，与数据的处理过程同时进行。
+func streamChunks(reader io.Reader, options HashOptions, consume func([]byte)) error {
+	onRead := options.OnRead
+	if onRead == nil {
+		onRead = func(int) {}
+	}
+	depth := int(options.ReadAheadBytes / hashBufferSize)
+	if options.ReadAheadBytes > 0 && depth == 0 {
+		depth = 1
+	}
+	if depth <= 0 {
+		buffer := make([]byte, hashBufferSize)
+		for {
+			n, err := io.ReadFull(reader, buffer)
+			if n > 0 {
+				onRead(n)
+				consume(buffer[:n])
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	var (
+		free   = make(chan []byte, depth+1)
+		filled = make(chan readChunk, depth)
+		done   = make(chan struct{})
+	)
+	defer close(done)
+	for i := 0; i <= depth; i++ {
+		free <- make([]byte, hashBufferSize)
+	}
+	go func() {
+		defer close(filled)
+		for {
+			var buffer []byte
+			select {
+			case buffer = <-free:
+			case <-done:
+				return
+			}
+			n, err := io.ReadFull(reader, buffer)
+			if n > 0 {
+				onRead(n)
+				select {
+				case filled <- readChunk{data: buffer[:n]}:
+				case <-done:
+					return
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return
+			}
+			if err != nil {
+				select {
+				case filled <- readChunk{err: err}:
+				case <-done:
+				}
+				return
+			}
+		}
+	}()
+	for chunk := range filled {
+		if chunk.err != nil {
+			return chunk.err
+		}
+		consume(chunk.data)
+		free <- chunk.data[:cap(chunk.data)]
+	}
+	return nil
+}
+
+// 只读取一遍文件，同时计算SHA256、CRC32、BLAKE3、AutoV1和AutoV2。
+func HashFile(filePath string) (*FileHashes, error) {
+	return HashFileWithOptions(filePath, HashOptions{})
+}
+
+// 使用指定的读取选项计算文件的全部Hash值。
+func HashFileWithOptions(filePath string, options HashOptions) (*FileHashes, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("未能打开文件，%w", err)
+	}
+	defer file.Close()
+	var (
+		sha256Hash = sha256.New()
+		crc32Hash  = crc32.NewIEEE()
+		blake3Hash = blake3.New(32, nil)
+		autoV1     = &autoV1Writer{hash: sha256.New()}
+		writer     = io.MultiWriter(sha256Hash, crc32Hash, blake3Hash, autoV1)
+	)
+	err = streamChunks(file, options, func(data []byte) {
+		writer.Write(data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取文件计算Hash失败，%w", err)
+	}
+	sha256Hex := upperHex(sha256Hash.Sum(nil))
+	return &FileHashes{
+		SHA256: sha256Hex,
+		CRC32:  fmt.Sprintf("%08X", crc32Hash.Sum32()), // Civitai使用大端序的CRC32，与`zlib.crc32`的`%08X`输出相同。
+		BLAKE3: upperHex(blake3Hash.Sum(nil)),
+		AutoV1: upperHex(autoV1.hash.Sum(nil))[:8],
+		AutoV2: AutoV2FromSHA256(sha256Hex),
+	}, nil
+}
+
+// AutoV2就是文件SHA256值的前10位。
+func AutoV2FromSHA256(sha256Hex string) string {
+	if len(sha256Hex) < 10 {
+		return strings.ToUpper(sha256Hex)
+	}
+	return strings.ToUpper(sha256Hex[:10])
+}
+
+// 单独计算文件的AutoV1值，只需要读取文件中的一小部分，用于为已经记录的文件补充AutoV1值。
+func AutoV1File(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("未能打开文件，%w", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(autoV1Offset, io.SeekStart); err != nil {
+		return "", fmt.Errorf("未能定位文件读取位置，%w", err)
+	}
+	autoV1 := sha256.New()
+	if _, err := io.CopyN(autoV1, file, autoV1Length); err != nil && err != io.EOF {
+		return "", fmt.Errorf("读取文件计算Hash失败，%w", err)
+	}
+	return upperHex(autoV1.Sum(nil))[:8], nil
+}
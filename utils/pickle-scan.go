@@ -0,0 +1,435 @@
+package utils
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// pickle安全检查的结论。
+const (
+	PickleSafe       = "safe"       // 引用的全部对象均在允许列表中。
+	PickleSuspicious = "suspicious" // 引用了允许列表之外的对象，但不在已知的危险对象列表中。
+	PickleDangerous  = "dangerous"  // 引用了可以执行任意代码的对象。
+)
+
+var ErrInvalidPickle = errors.New("无效的pickle数据")
+
+// 加载模型时可以安全引用的对象，与SD WebUI的安全加载器保持一致。键为模块名称，值为对象名称，"*"表示模块中的全部对象。
+var pickleSafeGlobals = map[string][]string{
+	"collections": {"OrderedDict"},
+	"torch._utils": {"_rebuild_tensor", "_rebuild_tensor_v2", "_rebuild_parameter", "_rebuild_parameter_with_state",
+		"_rebuild_device_tensor_from_numpy", "_rebuild_qtensor", "_rebuild_sparse_tensor", "_rebuild_meta_tensor_no_storage"},
+	"torch._tensor": {"_rebuild_from_type_v2"},
+	"torch": {"BFloat16Storage", "BoolStorage", "ByteStorage", "CharStorage", "ComplexDoubleStorage", "ComplexFloatStorage",
+		"DoubleStorage", "FloatStorage", "HalfStorage", "IntStorage", "LongStorage", "ShortStorage", "Size",
+		"bfloat16", "float16", "float32", "float64", "int8", "int16", "int32", "int64", "uint8", "bool", "device", "dtype"},
+	"torch.nn.modules.container": {"ParameterDict"},
+	"numpy.core.multiarray":      {"scalar", "_reconstruct"},
+	"numpy":                      {"dtype", "ndarray"},
+	"_codecs":                    {"encode"},
+	"pytorch_lightning.callbacks.model_checkpoint": {"ModelCheckpoint"},
+	"pytorch_lightning.callbacks.early_stopping":   {"EarlyStopping"},
+	"builtins":    {"set", "frozenset", "dict", "list", "tuple", "slice", "bytearray"},
+	"__builtin__": {"set", "frozenset", "dict", "list", "tuple", "slice", "bytearray"},
+}
+
+// 可以用来执行任意代码或者访问系统的对象，与picklescan的危险对象列表保持一致。
+var pickleDangerousGlobals = map[string][]string{
+	"builtins":      {"eval", "exec", "execfile", "compile", "open", "getattr", "apply", "__import__", "breakpoint", "globals", "locals", "input"},
+	"__builtin__":   {"eval", "exec", "execfile", "compile", "open", "getattr", "apply", "__import__", "breakpoint", "globals", "locals", "input"},
+	"os":            {"*"},
+	"nt":            {"*"},
+	"posix":         {"*"},
+	"subprocess":    {"*"},
+	"sys":           {"*"},
+	"socket":        {"*"},
+	"shutil":        {"*"},
+	"runpy":         {"*"},
+	"webbrowser":    {"*"},
+	"pty":           {"*"},
+	"httplib":       {"*"},
+	"requests":      {"*"},
+	"aiohttp":       {"*"},
+	"asyncio":       {"*"},
+	"bdb":           {"*"},
+	"pdb":           {"*"},
+	"operator":      {"attrgetter"},
+	"pickle":        {"*"},
+	"_pickle":       {"*"},
+	"torch.storage": {"_load_from_bytes"},
+}
+
+// 对pickle数据进行静态分析的结果。
+type PickleScanResult struct {
+	Verdict    string   `json:"verdict"`
+	Globals    []string `json:"globals"`    // 数据中引用的全部对象，形式为“模块.对象”。
+	Dangerous  []string `json:"dangerous"`  // 引用的危险对象。
+	Suspicious []string `json:"suspicious"` // 引用的允许列表之外的其他对象。
+}
+
+func matchGlobal(globals map[string][]string, module, name string) bool {
+	names, ok := globals[module]
+	if !ok {
+		return false
+	}
+	for _, candidate := range names {
+		if candidate == "*" || candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pickle操作码的参数形式。
+const (
+	pickleArgNone = iota
+	pickleArgLine
+	pickleArgTwoLines
+	pickleArgFixed
+	pickleArgSized
+)
+
+type pickleOpcode struct {
+	kind int
+	size int // 固定长度参数的字节数，或者参数长度前缀的字节数。
+}
+
+// 协议0至5中的全部操作码。
+var pickleOpcodes = map[byte]pickleOpcode{
+	'(': {pickleArgNone, 0}, '.': {pickleArgNone, 0}, '0': {pickleArgNone, 0}, '1': {pickleArgNone, 0},
+	'2': {pickleArgNone, 0}, 'F': {pickleArgLine, 0}, 'I': {pickleArgLine, 0}, 'J': {pickleArgFixed, 4},
+	'K': {pickleArgFixed, 1}, 'L': {pickleArgLine, 0}, 'M': {pickleArgFixed, 2}, 'N': {pickleArgNone, 0},
+	'P': {pickleArgLine, 0}, 'Q': {pickleArgNone, 0}, 'R': {pickleArgNone, 0}, 'S': {pickleArgLine, 0},
+	'T': {pickleArgSized, 4}, 'U': {pickleArgSized, 1}, 'V': {pickleArgLine, 0}, 'X': {pickleArgSized, 4},
+	'a': {pickleArgNone, 0}, 'b': {pickleArgNone, 0}, 'c': {pickleArgTwoLines, 0}, 'd': {pickleArgNone, 0},
+	'}': {pickleArgNone, 0}, 'e': {pickleArgNone, 0}, 'g': {pickleArgLine, 0}, 'h': {pickleArgFixed, 1},
+	'i': {pickleArgTwoLines, 0}, 'j': {pickleArgFixed, 4}, 'l': {pickleArgNone, 0}, ']': {pickleArgNone, 0},
+	'o': {pickleArgNone, 0}, 'p': {pickleArgLine, 0}, 'q': {pickleArgFixed, 1}, 'r': {pickleArgFixed, 4},
+	's': {pickleArgNone, 0}, 't': {pickleArgNone, 0}, ')': {pickleArgNone, 0}, 'u': {pickleArgNone, 0},
+	'G': {pickleArgFixed, 8},
+	// 协议2
+	0x80: {pickleArgFixed, 1}, 0x81: {pickleArgNone, 0}, 0x82: {pickleArgFixed, 1}, 0x83: {pickleArgFixed, 2},
+	0x84: {pickleArgFixed, 4}, 0x85: {pickleArgNone, 0}, 0x86: {pickleArgNone, 0}, 0x87: {pickleArgNone, 0},
+	0x88: {pickleArgNone, 0}, 0x89: {pickleArgNone, 0}, 0x8a: {pickleArgSized, 1}, 0x8b: {pickleArgSized, 4},
+	// 协议3
+	'B': {pickleArgSized, 4}, 'C': {pickleArgSized, 1},
+	// 协议4
+	0x8c: {pickleArgSized, 1}, 0x8d: {pickleArgSized, 8}, 0x8e: {pickleArgSized, 8}, 0x8f: {pickleArgNone, 0},
+	0x90: {pickleArgNone, 0}, 0x91: {pickleArgNone, 0}, 0x92: {pickleArgNone, 0}, 0x93: {pickleArgNone, 0},
+	0x94: {pickleArgNone, 0}, 0x95: {pickleArgFixed, 8},
+	// 协议5
+	0x96: {pickleArgSized, 8}, 0x97: {pickleArgNone, 0}, 0x98: {pickleArgNone, 0},
+}
+
+const (
+	// 单个参数允许的最大长度，超过此长度的数据视为已经不是pickle数据。
+	maxPickleArgSize = 1 << 30
+	// 以换行结尾的参数允许的最大长度。
+	maxPickleLineSize = 64 * 1024
+	// 超过此长度的字符串不可能是模块或者对象名称，直接跳过而不读入内存。
+	maxPickleStringSize = 64 * 1024
+)
+
+func readPickleLine(reader *bufio.Reader) (string, error) {
+	line := make([]byte, 0, 64)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			return strings.TrimRight(string(line), "\r"), nil
+		}
+		if len(line) >= maxPickleLineSize {
+			return "", errors.New("行数据过长")
+		}
+		line = append(line, b)
+	}
+}
+
+func readPickleLength(reader *bufio.Reader, size int) (uint64, error) {
+	buffer := make([]byte, 8)
+	if _, err := io.ReadFull(reader, buffer[:size]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buffer), nil
+}
+
+// 只压入一个非字符串值的操作码，例如None、数字、空容器和字节数据。
+var pickleValuePushOpcodes = map[byte]bool{
+	'N': true, 'I': true, 'J': true, 'K': true, 'L': true, 'M': true, 'F': true, 'G': true,
+	']': true, '}': true, ')': true, 0x88: true, 0x89: true, 0x8a: true, 0x8b: true, 0x8f: true,
+	'B': true, 'C': true, 0x8e: true, 0x96: true,
+}
+
+// 逐个读取一个pickle数据流中的操作码，收集其中通过GLOBAL、INST和STACK_GLOBAL引用的对象，直到遇到STOP操作码。
+// STACK_GLOBAL使用栈上的两个字符串作为模块和对象名称，这里模拟字符串的压入、POP、DUP以及memo的存取来推断栈顶的内容。
+// 对栈的影响无法简单模拟的操作码会清空模拟的栈，此后无法推断的STACK_GLOBAL记录为未知对象，并被判定为危险。
+func scanPickleStream(reader *bufio.Reader) ([][2]string, error) {
+	var (
+		globals = make([][2]string, 0)
+		// 模拟的栈顶部分，nil表示不是字符串的值。栈被清空之后，更下方的内容均视为未知。
+		stack     = make([]*string, 0)
+		memo      = make(map[uint64]string)
+		memoCount uint64
+		push      = func(value *string) { stack = append(stack, value) }
+		top       = func() *string {
+			if len(stack) == 0 {
+				return nil
+			}
+			return stack[len(stack)-1]
+		}
+		storeMemo = func(index uint64) {
+			if value := top(); value != nil {
+				memo[index] = *value
+			} else {
+				delete(memo, index)
+			}
+		}
+	)
+	for {
+		code, err := reader.ReadByte()
+		if err != nil {
+			return globals, fmt.Errorf("%w，数据在STOP之前结束", ErrInvalidPickle)
+		}
+		opcode, ok := pickleOpcodes[code]
+		if !ok {
+			return globals, fmt.Errorf("%w，未知的操作码0x%02x", ErrInvalidPickle, code)
+		}
+		var (
+			argument  []byte
+			discarded bool
+		)
+		switch opcode.kind {
+		case pickleArgLine:
+			line, err := readPickleLine(reader)
+			if err != nil {
+				return globals, fmt.Errorf("%w，%s", ErrInvalidPickle, err)
+			}
+			argument = []byte(line)
+		case pickleArgTwoLines:
+			module, err := readPickleLine(reader)
+			if err != nil {
+				return globals, fmt.Errorf("%w，%s", ErrInvalidPickle, err)
+			}
+			name, err := readPickleLine(reader)
+			if err != nil {
+				return globals, fmt.Errorf("%w，%s", ErrInvalidPickle, err)
+			}
+			globals = append(globals, [2]string{module, name})
+		case pickleArgFixed:
+			argument = make([]byte, opcode.size)
+			if _, err := io.ReadFull(reader, argument); err != nil {
+				return globals, fmt.Errorf("%w，%s", ErrInvalidPickle, err)
+			}
+		case pickleArgSized:
+			length, err := readPickleLength(reader, opcode.size)
+			if err != nil {
+				return globals, fmt.Errorf("%w，%s", ErrInvalidPickle, err)
+			}
+			if length > maxPickleArgSize {
+				return globals, fmt.Errorf("%w，参数长度 %d 过大", ErrInvalidPickle, length)
+			}
+			// 字节数据只需要跳过，字符串数据需要保留以推断STACK_GLOBAL引用的对象。
+			if code == 'B' || code == 'C' || code == 0x8e || code == 0x96 || code == 0x8a || code == 0x8b || length > maxPickleStringSize {
+				if _, err := reader.Discard(int(length)); err != nil {
+					return globals, fmt.Errorf("%w，%s", ErrInvalidPickle, err)
+				}
+				discarded = true
+			} else {
+				argument = make([]byte, length)
+				if _, err := io.ReadFull(reader, argument); err != nil {
+					return globals, fmt.Errorf("%w，%s", ErrInvalidPickle, err)
+				}
+			}
+		}
+		switch {
+		case code == 'X' || code == 0x8c || code == 0x8d || code == 'T' || code == 'U':
+			if discarded {
+				// 过长的字符串不可能是模块或者对象名称。
+				push(nil)
+			} else {
+				value := string(argument)
+				push(&value)
+			}
+		case code == 'V' || code == 'S':
+			value := strings.Trim(string(argument), `"'`)
+			push(&value)
+		case pickleValuePushOpcodes[code]:
+			push(nil)
+		case code == 0x94:
+			storeMemo(memoCount)
+			memoCount++
+		case code == 'q' || code == 'r' || code == 'p':
+			storeMemo(pickleMemoIndex(code, argument))
+		case code == 'h' || code == 'j' || code == 'g':
+			if value, ok := memo[pickleMemoIndex(code, argument)]; ok {
+				push(&value)
+			} else {
+				push(nil)
+			}
+		case code == '0':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case code == '2':
+			if len(stack) > 0 {
+				push(top())
+			}
+		case code == 0x93:
+			module, name := "?", "?"
+			if len(stack) >= 2 && stack[len(stack)-2] != nil && stack[len(stack)-1] != nil {
+				module, name = *stack[len(stack)-2], *stack[len(stack)-1]
+			}
+			globals = append(globals, [2]string{module, name})
+			if len(stack) >= 2 {
+				stack = append(stack[:len(stack)-2], nil)
+			} else {
+				stack = stack[:0]
+			}
+		case code == 'c':
+			push(nil)
+		case code == '.':
+			return globals, nil
+		case code == 0x95:
+			// FRAME只是分帧标记，不影响栈上的内容。
+		default:
+			// POP_MARK、MARK以及构造对象等操作码对栈的影响依赖MARK的位置或者对象的内容，不再推断更下方的内容。
+			stack = stack[:0]
+		}
+	}
+}
+
+func pickleMemoIndex(code byte, argument []byte) uint64 {
+	switch code {
+	case 'q', 'h':
+		return uint64(argument[0])
+	case 'r', 'j':
+		return uint64(binary.LittleEndian.Uint32(argument))
+	default:
+		var index uint64
+		fmt.Sscanf(string(argument), "%d", &index)
+		return index
+	}
+}
+
+// 根据引用的对象得出检查结论。
+func summarizePickleGlobals(globals [][2]string) *PickleScanResult {
+	result := &PickleScanResult{
+		Verdict:    PickleSafe,
+		Globals:    make([]string, 0),
+		Dangerous:  make([]string, 0),
+		Suspicious: make([]string, 0),
+	}
+	seen := make(map[string]bool)
+	for _, global := range globals {
+		module, name := global[0], global[1]
+		fullName := module + "." + name
+		if seen[fullName] {
+			continue
+		}
+		seen[fullName] = true
+		result.Globals = append(result.Globals, fullName)
+		switch {
+		case module == "?" || name == "?":
+			result.Dangerous = append(result.Dangerous, fullName)
+		case matchGlobal(pickleDangerousGlobals, module, name):
+			result.Dangerous = append(result.Dangerous, fullName)
+		case matchGlobal(pickleSafeGlobals, module, name):
+		default:
+			result.Suspicious = append(result.Suspicious, fullName)
+		}
+	}
+	sort.Strings(result.Globals)
+	sort.Strings(result.Dangerous)
+	sort.Strings(result.Suspicious)
+	if len(result.Dangerous) > 0 {
+		result.Verdict = PickleDangerous
+	} else if len(result.Suspicious) > 0 {
+		result.Verdict = PickleSuspicious
+	}
+	return result
+}
+
+// 检查PyTorch zip格式文件中全部的pickle数据。
+func scanTorchZip(filePath string) ([][2]string, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("未能打开模型文件压缩包，%w", err)
+	}
+	defer archive.Close()
+	globals := make([][2]string, 0)
+	for _, entry := range archive.File {
+		if !strings.HasSuffix(entry.Name, ".pkl") {
+			continue
+		}
+		content, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("未能读取压缩包中的 [%s]，%w", entry.Name, err)
+		}
+		entryGlobals, err := scanPickleStream(bufio.NewReader(content))
+		content.Close()
+		globals = append(globals, entryGlobals...)
+		if err != nil {
+			return globals, fmt.Errorf("压缩包中的 [%s] 不是有效的pickle数据，%w", entry.Name, err)
+		}
+	}
+	return globals, nil
+}
+
+// 检查旧式PyTorch文件。旧式文件由连续的多个pickle数据流和其后的张量数据组成，第一个数据流之后遇到无法解析的数据时即认为已经到达张量数据。
+func scanLegacyPickle(filePath string) ([][2]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("未能打开模型文件，%w", err)
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	globals := make([][2]string, 0)
+	for i := 0; ; i++ {
+		streamGlobals, err := scanPickleStream(reader)
+		globals = append(globals, streamGlobals...)
+		if err != nil {
+			if i == 0 {
+				return globals, err
+			}
+			return globals, nil
+		}
+		if _, err := reader.Peek(1); err != nil {
+			return globals, nil
+		}
+	}
+}
+
+// 对PyTorch格式的模型文件进行静态安全检查，不会执行其中的任何内容。不是PyTorch格式的文件返回nil。
+// 数据无法完整解析时，已经解析出的部分仍然会参与判断，并且至少判定为可疑。
+func ScanPickleFile(filePath string) (*PickleScanResult, error) {
+	format, err := DetectModelFormat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var globals [][2]string
+	switch format {
+	case FormatTorchZip:
+		globals, err = scanTorchZip(filePath)
+	case FormatPickle:
+		globals, err = scanLegacyPickle(filePath)
+	default:
+		return nil, nil
+	}
+	if globals == nil && err != nil {
+		return nil, err
+	}
+	result := summarizePickleGlobals(globals)
+	if err != nil && result.Verdict == PickleSafe {
+		result.Verdict = PickleSuspicious
+	}
+	return result, nil
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// 组装协议4中的SHORT_BINUNICODE操作。
+func shortUnicode(value string) []byte {
+	return append([]byte{0x8c, byte(len(value))}, value...)
+}
+
+func pickleBytes(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func scanPickleBytes(t *testing.T, data []byte) *PickleScanResult {
+	t.Helper()
+	globals, err := scanPickleStream(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("解析pickle数据失败：%s", err)
+	}
+	return summarizePickleGlobals(globals)
+}
+
+func TestScanPickleGlobal(t *testing.T) {
+	data := pickleBytes(
+		[]byte{0x80, 0x02},
+		[]byte("cos\nsystem\n"),
+		[]byte("X"), []byte{0x02, 0, 0, 0}, []byte("id"),
+		[]byte{0x85, 'R', '.'},
+	)
+	result := scanPickleBytes(t, data)
+	if result.Verdict != PickleDangerous || !reflect.DeepEqual(result.Dangerous, []string{"os.system"}) {
+		t.Errorf("GLOBAL引用的os.system应该被判定为危险，实际结果：%+v", result)
+	}
+}
+
+func TestScanPickleStackGlobal(t *testing.T) {
+	data := pickleBytes(
+		[]byte{0x80, 0x04},
+		shortUnicode("collections"), []byte{0x94},
+		shortUnicode("OrderedDict"), []byte{0x94},
+		[]byte{0x93, 0x94, ')', 'R', '.'},
+	)
+	result := scanPickleBytes(t, data)
+	if result.Verdict != PickleSafe || !reflect.DeepEqual(result.Globals, []string{"collections.OrderedDict"}) {
+		t.Errorf("STACK_GLOBAL引用的collections.OrderedDict应该被判定为安全，实际结果：%+v", result)
+	}
+}
+
+func TestScanPickleMemoRoundTrip(t *testing.T) {
+	// 第一次引用torch.FloatStorage之后，第二次STACK_GLOBAL从memo中取出相同的模块名称和另一个对象名称。
+	data := pickleBytes(
+		[]byte{0x80, 0x04},
+		shortUnicode("torch"), []byte{0x94},
+		shortUnicode("FloatStorage"), []byte{0x94},
+		[]byte{0x93, 0x94, '0'},
+		[]byte{'h', 0x00},
+		shortUnicode("load"), []byte{0x94},
+		[]byte{0x93, '.'},
+	)
+	result := scanPickleBytes(t, data)
+	expected := []string{"torch.FloatStorage", "torch.load"}
+	if !reflect.DeepEqual(result.Globals, expected) {
+		t.Errorf("从memo中取出的字符串应该参与推断，期望引用 %v，实际结果：%+v", expected, result)
+	}
+	if result.Verdict != PickleSuspicious {
+		t.Errorf("torch.load不在允许列表中，应该被判定为可疑，实际结果：%s", result.Verdict)
+	}
+}
+
+func TestScanPicklePopBypass(t *testing.T) {
+	// 压入os和system之后再压入一个安全的对象名称并全部弹出，STACK_GLOBAL实际引用的是os.system。
+	data := pickleBytes(
+		[]byte{0x80, 0x04},
+		shortUnicode("os"),
+		shortUnicode("system"),
+		shortUnicode("collections"),
+		shortUnicode("OrderedDict"),
+		[]byte{'0', '0'},
+		[]byte{0x93, '.'},
+	)
+	result := scanPickleBytes(t, data)
+	if result.Verdict != PickleDangerous || !reflect.DeepEqual(result.Dangerous, []string{"os.system"}) {
+		t.Errorf("POP之后的STACK_GLOBAL应该引用os.system，实际结果：%+v", result)
+	}
+}
+
+func TestScanPickleUnresolvedStackGlobal(t *testing.T) {
+	// POP_MARK之后无法确定栈上的内容，STACK_GLOBAL只能记录为未知对象。
+	data := pickleBytes(
+		[]byte{0x80, 0x04},
+		shortUnicode("os"),
+		shortUnicode("system"),
+		[]byte{'('},
+		shortUnicode("collections"),
+		[]byte{'1'},
+		[]byte{0x93, '.'},
+	)
+	result := scanPickleBytes(t, data)
+	if result.Verdict != PickleDangerous || !reflect.DeepEqual(result.Dangerous, []string{"?.?"}) {
+		t.Errorf("无法推断的STACK_GLOBAL应该被判定为危险，实际结果：%+v", result)
+	}
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Safetensors文件头的最大长度，超过这个长度的文件头被认为是损坏的文件。
+const maxSafetensorsHeaderSize = 100 * 1024 * 1024
+
+var ErrInvalidSafetensors = errors.New("不是有效的Safetensors文件")
+
+type SafetensorsTensor struct {
+	DType       string   `json:"dtype"`
+	Shape       []int64  `json:"shape"`
+	DataOffsets [2]int64 `json:"data_offsets"`
+}
+
+// Safetensors文件的文件头，包括全部张量的描述和文件中内嵌的元数据。
+type SafetensorsHeader struct {
+	Metadata map[string]string
+	Tensors  map[string]SafetensorsTensor
+}
+
+// 读取Safetensors文件的文件头。文件的前8个字节是小端序的文件头长度，其后是JSON格式的文件头，读取时不会加载任何张量数据。
+func ReadSafetensorsHeader(filePath string) (*SafetensorsHeader, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("未能打开模型文件，%w", err)
+	}
+	defer file.Close()
+	var headerSize uint64
+	if err := binary.Read(file, binary.LittleEndian, &headerSize); err != nil {
+		return nil, fmt.Errorf("%w，未能读取文件头长度，%s", ErrInvalidSafetensors, err)
+	}
+	if headerSize < 2 || headerSize > maxSafetensorsHeaderSize {
+		return nil, fmt.Errorf("%w，文件头长度 %d 超出范围", ErrInvalidSafetensors, headerSize)
+	}
+	headerContent := make([]byte, headerSize)
+	if _, err := io.ReadFull(file, headerContent); err != nil {
+		return nil, fmt.Errorf("%w，未能读取文件头，%s", ErrInvalidSafetensors, err)
+	}
+	var rawHeader map[string]json.RawMessage
+	if err := json.Unmarshal(headerContent, &rawHeader); err != nil {
+		return nil, fmt.Errorf("%w，文件头不是有效的JSON，%s", ErrInvalidSafetensors, err)
+	}
+	header := &SafetensorsHeader{
+		Metadata: make(map[string]string, 0),
+		Tensors:  make(map[string]SafetensorsTensor, len(rawHeader)),
+	}
+	for key, value := range rawHeader {
+		if key == "__metadata__" {
+			// 元数据中的值按照规范都应该是字符串，非字符串的值将保留其原始JSON形式。
+			var metadata map[string]json.RawMessage
+			if err := json.Unmarshal(value, &metadata); err != nil {
+				continue
+			}
+			for metaKey, metaValue := range metadata {
+				var text string
+				if err := json.Unmarshal(metaValue, &text); err != nil {
+					text = string(metaValue)
+				}
+				header.Metadata[metaKey] = text
+			}
+			continue
+		}
+		var tensor SafetensorsTensor
+		if err := json.Unmarshal(value, &tensor); err != nil {
+			return nil, fmt.Errorf("%w，张量 %s 的描述无法解析，%s", ErrInvalidSafetensors, key, err)
+		}
+		header.Tensors[key] = tensor
+	}
+	return header, nil
+}